@@ -33,6 +33,20 @@ if !errorlevel! neq 0 (
     exit /b 1
 )
 
+echo Building srpctl for Windows...
+go build -trimpath -ldflags "%LDFLAGS%" -o "..\bin\srpctl.exe" "..\cmd\srpctl\main.go"
+if !errorlevel! neq 0 (
+    echo Failed to build srpctl for Windows
+    exit /b 1
+)
+
+echo Building srpreplay for Windows...
+go build -trimpath -ldflags "%LDFLAGS%" -o "..\bin\srpreplay.exe" "..\cmd\srpreplay\main.go"
+if !errorlevel! neq 0 (
+    echo Failed to build srpreplay for Windows
+    exit /b 1
+)
+
 :: 编译Linux版本
 echo.
 echo Building Linux binaries...
@@ -53,12 +67,26 @@ if !errorlevel! neq 0 (
     exit /b 1
 )
 
+echo Building srpctl for Linux...
+go build -trimpath -ldflags "%LDFLAGS%" -o "..\bin\srpctl" "..\cmd\srpctl\main.go"
+if !errorlevel! neq 0 (
+    echo Failed to build srpctl for Linux
+    exit /b 1
+)
+
+echo Building srpreplay for Linux...
+go build -trimpath -ldflags "%LDFLAGS%" -o "..\bin\srpreplay" "..\cmd\srpreplay\main.go"
+if !errorlevel! neq 0 (
+    echo Failed to build srpreplay for Linux
+    exit /b 1
+)
+
 echo.
 echo Build completed successfully!
 echo.
 echo Generated files:
-echo   Windows: client.exe, server.exe
-echo   Linux:   client_linux, server_linux
+echo   Windows: client.exe, server.exe, srpctl.exe, srpreplay.exe
+echo   Linux:   client, server, srpctl, srpreplay
 echo.
 echo All binaries are located in: ..\bin\
 
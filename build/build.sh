@@ -26,15 +26,23 @@ go build -trimpath -ldflags "$LDFLAGS" -o "../bin/client" "../cmd/client/main.go
 echo "Building server for Linux..."
 go build -trimpath -ldflags "$LDFLAGS" -o "../bin/server" "../cmd/server/main.go"
 
+echo "Building srpctl for Linux..."
+go build -trimpath -ldflags "$LDFLAGS" -o "../bin/srpctl" "../cmd/srpctl/main.go"
+
+echo "Building srpreplay for Linux..."
+go build -trimpath -ldflags "$LDFLAGS" -o "../bin/srpreplay" "../cmd/srpreplay/main.go"
+
 # 设置可执行权限
 chmod +x "../bin/client"
 chmod +x "../bin/server"
+chmod +x "../bin/srpctl"
+chmod +x "../bin/srpreplay"
 
 echo
 echo "Build completed successfully!"
 echo
 echo "Generated files:"
-echo "  Linux: client, server"
+echo "  Linux: client, server, srpctl, srpreplay"
 echo
 echo "All binaries are located in: ../bin/"
 
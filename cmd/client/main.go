@@ -1,37 +1,104 @@
 package main
 
 import (
-	"bufio"
 	"flag"
-	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"srp/internal/client"
 	"srp/internal/common"
+	"srp/pkg/i18n"
 	"srp/pkg/logger"
+	"srp/pkg/metrics"
 	"srp/pkg/utils"
+	"strconv"
 	"sync"
+	"time"
 )
 
 func main() {
-	logger.SetLogFormat()
-
-	serverIP := flag.String("server-ip", "127.0.0.1", "srp-server的IP地址")
-	serverPort := flag.Int("server-port", 6352, "srp-server监听的端口")
-	serviceIP := flag.String("service-ip", "127.0.0.1", "被转发服务的IP地址")
-	servicePort := flag.Int("service-port", 80, "被转发服务的端口")
-	serverPassword := flag.String("server-pwd", common.DefaultServerPasswd, "连接srp-server的密码")
-	protocol := flag.String("protocol", "tcp", "srp-client和被转发服务的通信协议，支持："+utils.Protocols2String(common.Protocols))
-	logLevel := flag.Int("log-level", 2, fmt.Sprintf("日志级别（1-%d）", logger.MaxLogLevel))
-	versionInfo := flag.Bool("version", false, "打印版本信息")
+	// 先确定语言，使命令行参数的说明也使用对应的语言
+	if err := i18n.Init(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	serverIP := flag.String("server-ip", "127.0.0.1", i18n.T("srp-server的IP地址"))
+	serverPort := flag.Int("server-port", 6352, i18n.T("srp-server监听的端口"))
+	serviceIP := flag.String("service-ip", "127.0.0.1", i18n.T("被转发服务的IP地址"))
+	servicePort := flag.Int("service-port", 80, i18n.T("被转发服务的端口"))
+	serverPassword := flag.String("server-pwd", common.DefaultServerPasswd, i18n.T("连接srp-server的密码"))
+	protocol := flag.String("protocol", "tcp", i18n.Sprintf("srp-client和被转发服务的通信协议，支持：%s", utils.Protocols2String(common.Protocols)))
+	tunnel := flag.String("tunnel", common.DefaultTunnelName, i18n.T("注册到srp-server的隧道名称"))
+	name := flag.String("name", "", i18n.T("srp-client名称，同一隧道的多个srp-client名称不能相同，默认为主机名"))
+	healthCheck := flag.String("health-check", "", i18n.T("服务健康检查方式，支持：tcp，http，默认不检查"))
+	healthInterval := flag.Duration("health-interval", 10*time.Second, i18n.T("服务健康检查间隔"))
+	healthTimeout := flag.Duration("health-timeout", 3*time.Second, i18n.T("服务健康检查超时时间"))
+	healthPath := flag.String("health-path", "/", i18n.T("HTTP健康检查的请求路径"))
+	metricsAddr := flag.String("metrics-addr", "", i18n.T("Prometheus指标接口/metrics的监听地址，如127.0.0.1:9101，默认不启用"))
+	maxPayloadSize := flag.String("max-payload-size", "1M", i18n.Sprintf("能够接收的协议帧有效载荷的最大长度，超过时断开与srp-server的连接，支持K、M、G单位，最小为%d", common.MinMaxPayloadSize))
+	flushDelay := flag.Duration("flush-delay", 0, i18n.T("控制连接合并写入前等待更多帧的时间，如1ms，增大可减少系统调用但增加延迟，0表示不等待，只合并写入期间到达的帧"))
+	conns := flag.Int("conns", 1, i18n.Sprintf("与srp-server之间的控制连接数，srp-server支持时用户连接分散到各条连接上，减少队头阻塞，最大为%d", common.MaxControlConns))
+	direct := flag.Bool("direct", false, i18n.T("为每个TCP用户连接单独建立与srp-server的直连数据连接，直接转发原始字节，不与其他连接共享控制连接，需要srp-server支持"))
+	pool := flag.Int("pool", 0, i18n.Sprintf("保持的空闲预建数据连接数，srp-server支持时TCP用户连接直接交给空闲的连接，不经由控制连接申请，0表示不预先建立，最大为%d", common.MaxPoolSize))
+	poolService := flag.Bool("pool-service", false, i18n.T("为每条预建数据连接预先建立服务连接，空闲一段时间后重新建立"))
+	encrypt := flag.Bool("encrypt", false, i18n.T("加密与srp-server之间的控制连接，以连接密码认证临时密钥交换，中间人每次握手只能猜测一次密码，截获握手也无法离线猜测，需要srp-server支持"))
+	obfs := flag.Bool("obfs", false, i18n.T("以混淆模式连接srp-server，握手和数据没有固定特征，同时启用-encrypt，需要srp-server使用-obfs"))
+	readTimeout := flag.Duration("read-timeout", common.DefaultReadTimeout, i18n.T("控制连接的读取超时时间，双方都支持心跳时，超过该时间未收到srp-server的数据则断开连接，0表示不超时"))
+	logLevel := flag.String("log-level", "debug", i18n.Sprintf("日志级别，支持：%s，兼容旧版本的1-3", i18n.Join(logger.Levels)))
+	logFormat := flag.String("log-format", "text", i18n.Sprintf("日志格式，支持：%s", i18n.Join(logger.Formats)))
+	logFile := flag.String("log-file", "", i18n.T("日志文件路径，默认输出到标准错误，收到SIGUSR1信号时重新打开"))
+	logMaxSize := flag.String("log-max-size", "100M", i18n.T("日志文件的最大大小，超过后轮转，支持K、M、G单位，0表示不按大小轮转"))
+	logMaxAge := flag.Duration("log-max-age", 0, i18n.T("日志文件的最长使用时间，超过后轮转，如24h，0表示不按时间轮转"))
+	logMaxBackups := flag.Int("log-max-backups", 7, i18n.T("保留的旧日志文件数量，0表示全部保留"))
+	logCompress := flag.Bool("log-compress", false, i18n.T("以gzip压缩旧日志文件"))
+	flag.String("lang", i18n.Lang(), i18n.Sprintf("界面语言，支持：%s，默认根据环境变量LANG选择", i18n.Join(i18n.Langs)))
+	versionInfo := flag.Bool("version", false, i18n.T("打印版本信息"))
 	flag.Parse()
 
-	logger.LogWithLevel(1, 1, fmt.Sprintf("srp-client，版本：%s", common.Version))
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var logOutput io.Writer = os.Stderr
+	if *logFile != "" {
+		maxSize, err := utils.ParseSize(*logMaxSize)
+		if err != nil {
+			log.Fatal(i18n.T("无效的日志文件大小，"), err)
+		}
+		rw, err := logger.OpenRotateWriter(*logFile, maxSize, *logMaxAge, *logMaxBackups, *logCompress)
+		if err != nil {
+			log.Fatal(i18n.T("无法打开日志文件，"), err)
+		}
+		defer rw.Close()
+		logger.ReopenOnSignal(rw)
+		logOutput = rw
+	}
+	if err := logger.Setup(logOutput, level, *logFormat); err != nil {
+		log.Fatal(err)
+	}
+	logger.Info("srp-client", "version", common.Version)
 	if *versionInfo {
 		os.Exit(0)
 	}
 
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+	maxPayload, err := common.ParseMaxPayloadSize(*maxPayloadSize)
+	if err != nil {
+		logger.Fatal("无效的有效载荷最大长度", "err", err)
+	}
+	// 读取超时需大于心跳间隔，否则空闲的控制连接会被断开
+	if *readTimeout != 0 && *readTimeout <= common.HeartbeatInterval {
+		logger.Fatal("read-timeout需大于心跳间隔", "heartbeat_interval", common.HeartbeatInterval)
+	}
+	if *conns < 1 || *conns > common.MaxControlConns {
+		logger.Fatal("conns超出范围", "conns", *conns, "max", common.MaxControlConns)
+	}
+	if *pool < 0 || *pool > common.MaxPoolSize {
+		logger.Fatal("pool超出范围", "pool", *pool, "max", common.MaxPoolSize)
+	}
+
 	srpClient := client.Client{
 		Config: client.Config{
 			ServerIP:       *serverIP,
@@ -40,16 +107,24 @@ func main() {
 			ServicePort:    *servicePort,
 			ServerPassword: *serverPassword,
 			ServerProtocol: *protocol,
-			LogLevel:       *logLevel,
+			Tunnel:         *tunnel,
+			Name:           *name,
+			HealthInterval: *healthInterval,
+			HealthTimeout:  *healthTimeout,
+			HealthPath:     *healthPath,
+			MaxPayloadSize: maxPayload,
+			ReadTimeout:    *readTimeout,
+			FlushDelay:     *flushDelay,
+			Encrypt:        *encrypt || *obfs,
+			Obfuscate:      *obfs,
+			Conns:          *conns,
+			Direct:         *direct,
+			Pool:           *pool,
+			PoolService:    *poolService,
 		},
 		ServerConn:    nil,
 		UserConnIDMap: make(map[uint32]net.Conn),
-		BufferPool: sync.Pool{
-			New: func() any {
-				return make([]byte, common.MaxBufferSize)
-			},
-		},
-		RWMu: &sync.RWMutex{},
+		RWMu:          &sync.RWMutex{},
 	}
 
 	// 根据命令行参数 protocol 选择协议
@@ -60,10 +135,28 @@ func main() {
 	case "udp":
 		srpClient.HandleServerData = srpClient.HandleServerDataUDP
 	default:
-		log.Fatal("不支持的协议：" + srpClient.ServerProtocol)
+		logger.Fatal("不支持的协议", "protocol", srpClient.ServerProtocol)
+	}
+	switch *healthCheck {
+	case "":
+	case "tcp":
+		srpClient.CheckHealth = srpClient.CheckHealthTCP
+	case "http":
+		srpClient.CheckHealth = srpClient.CheckHealthHTTP
+	default:
+		logger.Fatal("不支持的健康检查方式", "health_check", *healthCheck)
+	}
+	logger.Info("被转发服务地址", "service_addr", net.JoinHostPort(srpClient.ServiceIP, strconv.Itoa(srpClient.ServicePort)))
+	logger.Info("srp-server地址", "server_addr", net.JoinHostPort(srpClient.ServerIP, strconv.Itoa(srpClient.ServerPort)))
+
+	if *metricsAddr != "" {
+		registry := metrics.NewRegistry()
+		srpClient.RegisterMetrics(registry)
+		go func() {
+			logger.Fatal("无法提供指标接口", "err", metrics.ListenAndServe(*metricsAddr, registry))
+		}()
+		logger.Info("指标接口地址", "url", "http://"+*metricsAddr+"/metrics")
 	}
-	logger.LogWithLevel(srpClient.LogLevel, 1, fmt.Sprintf("被转发服务地址: %s:%d", srpClient.ServiceIP, srpClient.ServicePort))
-	logger.LogWithLevel(srpClient.LogLevel, 1, fmt.Sprintf("srp-server地址: %s:%d", srpClient.ServerIP, srpClient.ServerPort))
 
 	srpClient.EstablishServerConn()
 	defer func() {
@@ -71,36 +164,75 @@ func main() {
 			srpClient.ServerConn.Close()
 		}
 	}()
+	// 只启用 srp-server 也支持的功能
+	if srpClient.CheckHealth != nil {
+		if srpClient.Caps.Has(common.CapHealth) {
+			go srpClient.RunHealthCheck()
+		} else {
+			logger.Warn("srp-server不支持健康状态上报，不进行健康检查")
+		}
+	}
+	if srpClient.Caps.Has(common.CapHeartbeat) {
+		go srpClient.SendHeartbeat()
+	}
+	if srpClient.Pool > 0 {
+		if srpClient.ServerProtocol != "tcp" {
+			logger.Warn("预建数据连接只支持tcp协议，不预先建立数据连接")
+		} else if !srpClient.Caps.Has(common.CapPool) {
+			logger.Warn("srp-server不支持预建数据连接，不预先建立数据连接")
+		} else {
+			go srpClient.RunPool()
+		}
+	}
 
-	// 阻塞在处理 srp-server 的消息处
+	// 阻塞在处理 srp-server 的消息处，每条控制连接由一个 goroutine 处理，同一 cid 的帧总在同一条连接上
 	// 1.取出消息，若为新的用户连接，调用则向服务发送数据并处理连接
 	// 2.若为转发的流量，则转发到对应的连接
+	for _, link := range srpClient.Links[1:] {
+		go serveLink(&srpClient, link)
+	}
+	serveLink(&srpClient, srpClient.Links[0])
+}
+
+// serveLink 处理 srp-server 经由控制连接 link 发送的消息，任一控制连接断开时退出
+func serveLink(srpClient *client.Client, link *client.Link) {
 	data := common.Proto{}
-	reader := bufio.NewReader(srpClient.ServerConn)
 	for {
-		if err := data.DecodeProto(reader); err != nil {
+		if err := srpClient.ReadServerFrame(link, &data); err != nil {
 			srpClient.CloseServerConn()
 			srpClient.CloseAllServiceConn()
-			log.Fatal("无法处理srp-server的数据：" + err.Error())
+			logger.Fatal("无法处理srp-server的数据", "err", err)
 		}
+		srpClient.Stats.AddFrameIn()
 		switch data.Type {
+		case common.TypeHeartbeat, common.TypeHeartbeatAck:
+			srpClient.HandleHeartbeat(link, data)
 		case common.TypeNewConn:
 			go srpClient.HandleServerData(data)
 		case common.TypeForwarding:
 			conn := srpClient.GetUserConn(data.CID)
 			if conn == nil {
-				logger.LogWithLevel(srpClient.LogLevel, 2, fmt.Sprintf("无匹配的cid：%d", data.CID))
+				logger.Debug("无匹配的cid", "cid", data.CID)
+				data.Release()
 				continue
 			}
+			srpClient.Stats.AddUp(int(data.PayloadLen))
 			if _, err := conn.Write(data.Payload); err != nil {
-				logger.LogWithLevel(srpClient.LogLevel, 2, fmt.Sprintf("无法转发cid：%d的数据到服务：%s", data.CID, err))
+				logger.Warn("无法转发数据到服务", "cid", data.CID, "err", err)
 			}
-			logger.LogWithLevel(srpClient.LogLevel, 2, fmt.Sprintf("转发数据到服务，有效载荷大小：%dbyte", data.PayloadLen))
-			logger.LogWithLevel(srpClient.LogLevel, 3, "转发数据到srp-server：")
-			logger.LogWithLevel(srpClient.LogLevel, 3, data.String())
+			logger.Debug("转发数据到服务", "cid", data.CID, "bytes", data.PayloadLen)
+			logger.Trace("转发数据到服务", "data", data)
+			// 有效载荷来自缓冲池，写入服务后归还
+			data.Release()
+		case common.TypePause:
+			srpClient.PauseUserConn(data.CID)
+			logger.Debug("暂停读取服务的数据", "cid", data.CID)
+		case common.TypeResume:
+			srpClient.ResumeUserConn(data.CID)
+			logger.Debug("恢复读取服务的数据", "cid", data.CID)
 		case common.TypeDisconnect:
 			srpClient.CloseUserConn(data.CID)
-			logger.LogWithLevel(srpClient.LogLevel, 2, fmt.Sprintf("关闭cid：%d的连接，srp-server：%s", data.CID, data.Payload))
+			logger.Debug("关闭用户连接", "cid", data.CID, "reason", string(data.Payload))
 		}
 	}
 }
@@ -1,121 +1,275 @@
 package main
 
 import (
-	"errors"
 	"flag"
-	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"srp/internal/common"
 	"srp/internal/server"
+	"srp/internal/server/dashboard"
+	"srp/pkg/i18n"
 	"srp/pkg/logger"
+	"srp/pkg/metrics"
+	"srp/pkg/ratelimit"
 	"srp/pkg/utils"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 )
 
 func main() {
-	logger.SetLogFormat()
-
-	clientIP := flag.String("client-ip", "0.0.0.0", "srp-client连接的IP地址")
-	clientPort := flag.Int("client-port", 6352, "srp-client连接的端口")
-	userIP := flag.String("server-ip", "0.0.0.0", "用户访问被转发服务的IP地址")
-	userPort := flag.Int("user-port", 9352, "用户访问被转发服务的端口")
-	serverPassword := flag.String("server-pwd", common.DefaultServerPasswd, "srp-server连接密码")
-	protocol := flag.String("protocol", "tcp", "用户和srp-server间的通信协议，支持："+utils.Protocols2String(common.Protocols))
-	logLevel := flag.Int("log-level", 2, fmt.Sprintf("日志级别（1-%d）", logger.MaxLogLevel))
-	versionInfo := flag.Bool("version", false, "打印版本信息")
+	// 先确定语言，使命令行参数的说明也使用对应的语言
+	if err := i18n.Init(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+	var tunnelSpecs utils.StringSlice
+	clientIP := flag.String("client-ip", "0.0.0.0", i18n.T("srp-client连接的IP地址"))
+	clientPort := flag.Int("client-port", 6352, i18n.T("srp-client连接的端口"))
+	userIP := flag.String("server-ip", "0.0.0.0", i18n.T("用户访问被转发服务的IP地址"))
+	userPort := flag.Int("user-port", 9352, i18n.T("用户访问被转发服务的端口"))
+	serverPassword := flag.String("server-pwd", common.DefaultServerPasswd, i18n.T("srp-server连接密码"))
+	protocol := flag.String("protocol", "tcp", i18n.Sprintf("用户和srp-server间的通信协议，支持：%s", utils.Protocols2String(common.Protocols)))
+	balance := flag.String("balance", "round-robin", i18n.Sprintf("多个srp-client注册同一隧道时的负载均衡策略，支持：%s", i18n.Join(common.Balancers)))
+	compression := flag.String("compression", common.CompressionNone, i18n.Sprintf("与srp-client之间转发数据的压缩算法，srp-client也支持时启用，适合文本较多、链路较慢的服务，支持：%s", i18n.Join(common.Compressions)))
+	allow := flag.String("allow", "", i18n.T("允许连接的用户IP或CIDR，多个规则以逗号分隔，默认允许所有地址"))
+	deny := flag.String("deny", "", i18n.T("拒绝连接的用户IP或CIDR，多个规则以逗号分隔，优先于allow"))
+	rate := flag.String("rate", "", i18n.T("隧道的限速，格式：速率[:突发容量]，支持K、M、G单位，如10M:20M，默认不限速"))
+	clientRate := flag.String("client-rate", "", i18n.T("每个srp-client的限速，格式同rate"))
+	connRate := flag.String("conn-rate", "", i18n.T("每个用户连接的限速，格式同rate"))
+	maxConns := flag.Int("max-conns", 0, i18n.T("隧道的最大并发用户连接数，0表示不限制"))
+	maxConnsPerIP := flag.Int("max-conns-per-ip", 0, i18n.T("每个用户IP的最大并发连接数，0表示不限制"))
+	acceptRate := flag.String("accept-rate", "", i18n.T("每秒接受的新用户连接数，格式：速率[:突发容量]，默认不限制"))
+	flag.Var(&tunnelSpecs, "tunnel", i18n.Sprintf("隧道配置，可重复指定，格式：name=web,port=8080[,配置项=值...]\n"+
+		"配置项：ip、protocol、balance、compression、allow、deny、rate、client-rate、conn-rate、max-conns、max-conns-per-ip、accept-rate，\n"+
+		"含义同对应的命令行参数（ip对应server-ip），allow和deny的多个规则以|分隔，未指定的项使用对应命令行参数的值\n"+
+		"未指定该参数时使用名为%s的默认隧道", common.DefaultTunnelName))
+	tunnelFile := flag.String("tunnel-file", "", i18n.T("隧道配置文件，每行一个格式同tunnel参数的隧道配置，#开头的行为注释，\n"+
+		"可通过管理接口或SIGHUP信号重新加载，不能与tunnel参数同时使用"))
+	metricsAddr := flag.String("metrics-addr", "", i18n.T("Prometheus指标接口/metrics的监听地址，如127.0.0.1:9100，默认不启用"))
+	adminAddr := flag.String("admin-addr", "", i18n.T("管理接口的监听地址，如127.0.0.1:9200或unix:/run/srp.sock，默认不启用"))
+	adminToken := flag.String("admin-token", "", i18n.T("管理接口的访问令牌，监听TCP地址时必须指定"))
+	dashboardAddr := flag.String("dashboard-addr", "", i18n.T("网页控制台的监听地址，如0.0.0.0:9300，默认不启用"))
+	dashboardUser := flag.String("dashboard-user", "admin", i18n.T("网页控制台的登录用户名"))
+	dashboardPassword := flag.String("dashboard-password", "", i18n.T("网页控制台的登录密码，启用控制台时必须指定"))
+	logLevel := flag.String("log-level", "debug", i18n.Sprintf("日志级别，支持：%s，兼容旧版本的1-3", i18n.Join(logger.Levels)))
+	logFormat := flag.String("log-format", "text", i18n.Sprintf("日志格式，支持：%s", i18n.Join(logger.Formats)))
+	logFile := flag.String("log-file", "", i18n.T("日志文件路径，默认输出到标准错误，收到SIGUSR1信号时重新打开"))
+	logMaxSize := flag.String("log-max-size", "100M", i18n.T("日志文件的最大大小，超过后轮转，支持K、M、G单位，0表示不按大小轮转"))
+	logMaxAge := flag.Duration("log-max-age", 0, i18n.T("日志文件的最长使用时间，超过后轮转，如24h，0表示不按时间轮转"))
+	logMaxBackups := flag.Int("log-max-backups", 7, i18n.T("保留的旧日志文件数量，0表示全部保留"))
+	logCompress := flag.Bool("log-compress", false, i18n.T("以gzip压缩旧日志文件"))
+	accessLogFile := flag.String("access-log", "", i18n.T("用户连接的访问日志文件路径，每个结束的用户连接写入一条记录，-表示输出到标准输出，\n"+
+		"文件的轮转方式同日志文件，默认不记录"))
+	accessLogFormat := flag.String("access-log-format", "json", i18n.Sprintf("访问日志格式，支持：%s", i18n.Join(server.AccessLogFormats)))
+	recordDir := flag.String("record-dir", "", i18n.T("录制目录，将每个srp-client会话的协议帧写入该目录下的文件，可用srpreplay重放，用于调试，默认不启用"))
+	maxPayloadSize := flag.String("max-payload-size", "1M", i18n.Sprintf("能够接收的协议帧有效载荷的最大长度，超过时断开srp-client的连接，支持K、M、G单位，最小为%d", common.MinMaxPayloadSize))
+	readTimeout := flag.Duration("read-timeout", common.DefaultReadTimeout, i18n.T("控制连接的读取超时时间，双方都支持心跳时，超过该时间未收到srp-client的数据则断开连接，0表示不超时"))
+	flushDelay := flag.Duration("flush-delay", 0, i18n.T("控制连接合并写入前等待更多帧的时间，如1ms，增大可减少系统调用但增加延迟，0表示不等待，只合并写入期间到达的帧"))
+	requireEncryption := flag.Bool("require-encryption", false, i18n.T("拒绝未使用-encrypt加密控制连接的srp-client"))
+	obfs := flag.Bool("obfs", false, i18n.T("srp-client端口只接受使用-obfs的混淆模式连接，握手和数据没有固定特征，可避免被识别和阻断"))
+	captureDir := flag.String("capture-dir", "", i18n.T("抓包目录，将每个用户连接转发的数据写入该目录下的pcapng文件，可用Wireshark打开，用于调试，默认不启用"))
+	flag.String("lang", i18n.Lang(), i18n.Sprintf("界面语言，支持：%s，默认根据环境变量LANG选择", i18n.Join(i18n.Langs)))
+	versionInfo := flag.Bool("version", false, i18n.T("打印版本信息"))
 	flag.Parse()
 
-	logger.LogWithLevel(1, 1, fmt.Sprintf("srp-server，版本：%s", common.Version))
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	maxSize, err := utils.ParseSize(*logMaxSize)
+	if err != nil {
+		log.Fatal(i18n.T("无效的日志文件大小，"), err)
+	}
+	var logOutput io.Writer = os.Stderr
+	if *logFile != "" {
+		rw, err := logger.OpenRotateWriter(*logFile, maxSize, *logMaxAge, *logMaxBackups, *logCompress)
+		if err != nil {
+			log.Fatal(i18n.T("无法打开日志文件，"), err)
+		}
+		defer rw.Close()
+		logger.ReopenOnSignal(rw)
+		logOutput = rw
+	}
+	if err := logger.Setup(logOutput, level, *logFormat); err != nil {
+		log.Fatal(err)
+	}
+	logger.Info("srp-server", "version", common.Version)
 	if *versionInfo {
 		os.Exit(0)
 	}
 
+	// 解析隧道配置
+	base := server.TunnelConfig{
+		Name:            common.DefaultTunnelName,
+		UserIP:          *userIP,
+		UserPort:        *userPort,
+		ServiceProtocol: *protocol,
+		Balance:         *balance,
+		Compression:     *compression,
+		Allow:           utils.SplitList(*allow),
+		Deny:            utils.SplitList(*deny),
+		MaxConns:        *maxConns,
+		MaxConnsPerIP:   *maxConnsPerIP,
+	}
+	for _, l := range []struct {
+		name  string
+		value string
+		limit *ratelimit.Limit
+	}{
+		{"rate", *rate, &base.Rate},
+		{"client-rate", *clientRate, &base.ClientRate},
+		{"conn-rate", *connRate, &base.ConnRate},
+		{"accept-rate", *acceptRate, &base.AcceptRate},
+	} {
+		limit, err := ratelimit.ParseLimit(l.value)
+		if err != nil {
+			logger.Fatal("无效的限速配置", "flag", l.name, "err", err)
+		}
+		*l.limit = limit
+	}
+	tunnelConfigs := []server.TunnelConfig{base}
+	if *tunnelFile != "" {
+		if len(tunnelSpecs) > 0 {
+			logger.Fatal("tunnel-file不能与tunnel参数同时使用")
+		}
+		configs, err := server.LoadTunnelFile(*tunnelFile, base)
+		if err != nil {
+			logger.Fatal("无法读取隧道配置文件", "err", err)
+		}
+		tunnelConfigs = configs
+	} else if len(tunnelSpecs) > 0 {
+		tunnelConfigs = nil
+		for _, spec := range tunnelSpecs {
+			tc, err := server.ParseTunnelConfig(spec, base)
+			if err != nil {
+				logger.Fatal("无效的隧道配置", "err", err)
+			}
+			tunnelConfigs = append(tunnelConfigs, tc)
+		}
+	}
+
+	maxPayload, err := common.ParseMaxPayloadSize(*maxPayloadSize)
+	if err != nil {
+		logger.Fatal("无效的有效载荷最大长度", "err", err)
+	}
+	// 读取超时需大于心跳间隔，否则空闲的控制连接会被断开
+	if *readTimeout != 0 && *readTimeout <= common.HeartbeatInterval {
+		logger.Fatal("read-timeout需大于心跳间隔", "heartbeat_interval", common.HeartbeatInterval)
+	}
+
+	if *captureDir != "" {
+		if err := os.MkdirAll(*captureDir, 0755); err != nil {
+			logger.Fatal("无法创建抓包目录", "err", err)
+		}
+	}
+	if *recordDir != "" {
+		if err := os.MkdirAll(*recordDir, 0755); err != nil {
+			logger.Fatal("无法创建录制目录", "err", err)
+		}
+	}
+
+	var accessLog *server.AccessLog
+	if *accessLogFile != "" {
+		var w io.Writer = os.Stdout
+		if *accessLogFile != "-" {
+			rw, err := logger.OpenRotateWriter(*accessLogFile, maxSize, *logMaxAge, *logMaxBackups, *logCompress)
+			if err != nil {
+				logger.Fatal("无法打开访问日志文件", "err", err)
+			}
+			defer rw.Close()
+			logger.ReopenOnSignal(rw)
+			w = rw
+		}
+		if accessLog, err = server.NewAccessLog(w, *accessLogFormat); err != nil {
+			logger.Fatal("无效的访问日志配置", "err", err)
+		}
+	}
+
 	srpServer := server.Server{
 		Config: server.Config{
-			ClientIP:        *clientIP,
-			UserIP:          *userIP,
-			ClientPort:      *clientPort,
-			UserPort:        *userPort,
-			ServerPassword:  *serverPassword,
-			ServiceProtocol: *protocol,
-			LogLevel:        *logLevel,
+			ClientIP:       *clientIP,
+			ClientPort:     *clientPort,
+			ServerPassword: *serverPassword,
+			Tunnels:        tunnelConfigs,
+			TunnelFile:     *tunnelFile,
+			CaptureDir:     *captureDir,
+			RecordDir:      *recordDir,
+			BaseTunnel:     base,
+			MaxPayloadSize: maxPayload,
+			ReadTimeout:    *readTimeout,
+			FlushDelay:     *flushDelay,
+
+			RequireEncryption: *requireEncryption,
+			Obfuscate:         *obfs,
 		},
-		ClientConn:      nil,
 		CIDCounter:      0,
+		Tunnels:         make(map[string]*server.Tunnel),
 		UserConnIDMap:   make(map[uint32]net.Conn),
-		DataChan2User:   make(chan common.Proto, 100),
-		DataChan2Client: make(chan common.Proto, 100),
-		BufferPool: sync.Pool{
-			New: func() any {
-				return make([]byte, common.MaxBufferSize)
-			},
-		},
-		RWMu: &sync.RWMutex{},
+		UserConnInfoMap: make(map[uint32]*server.UserConnInfo),
+		Events:          server.NewEventLog(1000),
+		AccessLog:       accessLog,
+		RWMu:            &sync.RWMutex{},
 	}
 
-	// 根据命令行参数 protocol 选择协议
-	// 实现新的协议时，务必在此添加代码
-	switch srpServer.ServiceProtocol {
-	case "tcp":
-		srpServer.HandleNewConn = srpServer.HandleUserConnTCP
-		srpServer.AcceptUserConn = srpServer.AcceptUserConnTCP
-	case "udp":
-		srpServer.HandleNewConn = srpServer.HandleUserConnUDP
-		srpServer.AcceptUserConn = srpServer.AcceptUserConnUDP
-	default:
-		log.Fatal("不支持的协议：" + srpServer.ServiceProtocol)
-	}
-	logger.LogWithLevel(srpServer.LogLevel, 1, fmt.Sprintf("srp-client连接地址：%s:%d", srpServer.ClientIP, srpServer.ClientPort))
-	logger.LogWithLevel(srpServer.LogLevel, 1, fmt.Sprintf("用户访问地址：%s:%d", srpServer.UserIP, srpServer.UserPort))
-
-	go srpServer.AcceptUserConn()
-	go srpServer.AcceptClient()
-	defer srpServer.CloseClientConn()
+	logger.Info("srp-client连接地址", "addr", net.JoinHostPort(srpServer.ClientIP, strconv.Itoa(srpServer.ClientPort)))
+	for _, tc := range srpServer.Config.Tunnels {
+		if _, err := srpServer.StartTunnel(tc); err != nil {
+			logger.Fatal("无法创建隧道", "err", err)
+		}
+	}
 
-	// 通过 DataChan2Client 接收 user 消息，发送到 srp-client
-	// 通过 DataChan2User 接收 srp-client 消息，根据 cid 发送到 user
-	for {
-		select {
-		case data := <-srpServer.DataChan2Client:
-			if srpServer.ClientConn == nil {
-				continue
-			}
-			dataByte, err := data.EncodeProto()
-			if err != nil {
-				logger.LogWithLevel(srpServer.LogLevel, 2, "丢弃user发往srp-client的数据包，无法处理数据，"+err.Error())
-				continue
-			}
-			if _, err := srpServer.ClientConn.Write(dataByte); err != nil {
-				logger.LogWithLevel(srpServer.LogLevel, 2, "丢弃user发往srp-client的数据包，无法发送数据，"+err.Error())
-				if errors.Is(err, io.EOF) {
-					srpServer.CloseClientConn()
-					srpServer.CloseAllUserConn()
-				}
+	// 收到 SIGHUP 时重新加载隧道配置文件
+	if *tunnelFile != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				srpServer.ReloadTunnels()
 			}
-			logger.LogWithLevel(srpServer.LogLevel, 2, fmt.Sprintf("转发数据到srp-client，有效载荷大小：%dbyte", data.PayloadLen))
-			logger.LogWithLevel(srpServer.LogLevel, 3, "转发数据到srp-client：")
-			logger.LogWithLevel(srpServer.LogLevel, 3, data.String())
-		case data := <-srpServer.DataChan2User:
-			if data.Type == common.TypeDisconnect {
-				srpServer.CloseUserConn(data.CID)
-				logger.LogWithLevel(srpServer.LogLevel, 2, fmt.Sprintf("关闭user(cid：%d)的连接，srp-client：%s", data.CID, data.Payload))
-				continue
-			}
-			conn := srpServer.GetUserConn(data.CID)
-			if conn == nil {
-				logger.LogWithLevel(srpServer.LogLevel, 2, fmt.Sprintf("丢弃srp-client发往user的数据包，无效的cid：%d", data.CID))
-				continue
-			}
-			if _, err := conn.Write(data.Payload); err != nil {
-				logger.LogWithLevel(srpServer.LogLevel, 2, "丢弃srp-client发往user的数据包，无法发送数据，"+err.Error())
-				continue
-			}
-			logger.LogWithLevel(srpServer.LogLevel, 2, fmt.Sprintf("转发数据到user，有效载荷大小：%dbyte", data.PayloadLen))
-			logger.LogWithLevel(srpServer.LogLevel, 3, "转发数据到user：")
-			logger.LogWithLevel(srpServer.LogLevel, 3, data.String())
+		}()
+	}
+
+	if *metricsAddr != "" {
+		registry := metrics.NewRegistry()
+		srpServer.RegisterMetrics(registry)
+		go func() {
+			logger.Fatal("无法提供指标接口", "err", metrics.ListenAndServe(*metricsAddr, registry))
+		}()
+		logger.Info("指标接口地址", "url", "http://"+*metricsAddr+"/metrics")
+	}
+
+	if *adminAddr != "" {
+		if *adminToken == "" && !strings.HasPrefix(*adminAddr, "unix:") {
+			logger.Fatal("管理接口监听TCP地址时必须指定admin-token")
+		}
+		listener, err := server.ListenAdmin(*adminAddr)
+		if err != nil {
+			logger.Fatal("无法监听管理接口", "err", err)
+		}
+		go func() {
+			logger.Fatal("无法提供管理接口", "err", http.Serve(listener, srpServer.AdminHandler(*adminToken)))
+		}()
+		logger.Info("管理接口地址", "addr", *adminAddr)
+	}
+
+	if *dashboardAddr != "" {
+		if *dashboardPassword == "" {
+			logger.Fatal("启用网页控制台时必须指定dashboard-password")
 		}
+		console := dashboard.New(srpServer.AdminHandler(""), *dashboardUser, *dashboardPassword)
+		go func() {
+			logger.Fatal("无法提供网页控制台", "err", http.ListenAndServe(*dashboardAddr, console))
+		}()
+		logger.Info("网页控制台地址", "url", "http://"+*dashboardAddr+"/")
 	}
+
+	// user 发往 srp-client 的数据由各用户连接的读取 goroutine 发送，
+	// srp-client 发往 user 的数据由各用户连接的写入 goroutine 发送
+	defer srpServer.CloseAllClientConn()
+	srpServer.AcceptClient()
 }
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"srp/internal/common"
+	"srp/internal/ctl"
+	"srp/internal/server"
+	"srp/pkg/i18n"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `用法：srpctl [参数] <命令> [命令参数]
+
+命令：
+  status                  隧道和srp-client概览
+  tunnels                 列出隧道
+  clients                 列出已连接的srp-client
+  conns [隧道]            列出用户连接
+  stats <隧道>            隧道的状态和统计
+  events [-n 数量] [-f]   最近的事件，-f持续输出新事件
+  kill <cid>...           断开用户连接
+  disconnect <id>...      断开srp-client
+  enable <隧道>           启用隧道
+  disable <隧道>          停用隧道，拒绝新的用户连接
+  reload                  重新加载srp-server的隧道配置文件
+
+参数：
+`
+
+var jsonOutput bool
+
+func main() {
+	// 先确定语言，使命令行参数的说明也使用对应的语言
+	if err := i18n.Init(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "srpctl："+err.Error())
+		os.Exit(2)
+	}
+	addr := flag.String("addr", envOr("SRP_ADMIN_ADDR", "unix:/run/srp.sock"), i18n.T("srp-server管理接口的地址，如unix:/run/srp.sock或127.0.0.1:9200，默认读取环境变量SRP_ADMIN_ADDR"))
+	token := flag.String("token", os.Getenv("SRP_ADMIN_TOKEN"), i18n.T("管理接口的访问令牌，默认读取环境变量SRP_ADMIN_TOKEN"))
+	flag.BoolVar(&jsonOutput, "json", false, i18n.T("以JSON格式输出"))
+	flag.String("lang", i18n.Lang(), i18n.Sprintf("界面语言，支持：%s，默认根据环境变量LANG选择", i18n.Join(i18n.Langs)))
+	versionInfo := flag.Bool("version", false, i18n.T("打印版本信息"))
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), i18n.T(usage))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *versionInfo {
+		fmt.Println(i18n.Sprintf("srpctl，版本：%s", common.Version))
+		return
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := ctl.New(*addr, *token)
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	var err error
+	switch cmd {
+	case "status":
+		err = status(c)
+	case "tunnels":
+		err = tunnels(c)
+	case "clients":
+		err = clients(c)
+	case "conns":
+		if len(args) > 1 {
+			fatalUsage(i18n.T("conns最多指定一个隧道"))
+		}
+		err = conns(c, strings.Join(args, ""))
+	case "stats":
+		if len(args) != 1 {
+			fatalUsage(i18n.T("stats需要指定一个隧道"))
+		}
+		err = stats(c, args[0])
+	case "events":
+		err = events(c, args)
+	case "kill", "disconnect":
+		if len(args) == 0 {
+			fatalUsage(i18n.Sprintf("%s需要指定至少一个id", cmd))
+		}
+		err = eachID(args, func(id uint32) error {
+			if cmd == "kill" {
+				return c.KickConn(id)
+			}
+			return c.DisconnectClient(id)
+		})
+	case "enable", "disable":
+		if len(args) != 1 {
+			fatalUsage(i18n.Sprintf("%s需要指定一个隧道", cmd))
+		}
+		if err = c.SetTunnelEnabled(args[0], cmd == "enable"); err == nil {
+			printResult(map[string]string{"result": "ok"}, "ok")
+		}
+	case "reload":
+		err = reload(c)
+	default:
+		fatalUsage(i18n.Sprintf("未知的命令：%s", cmd))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("srpctl：%s", err))
+		os.Exit(1)
+	}
+}
+
+func status(c *ctl.Client) error {
+	ts, err := c.Tunnels()
+	if err != nil {
+		return err
+	}
+	cs, err := c.Clients()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printJSON(map[string]any{"tunnels": ts, "clients": cs})
+		return nil
+	}
+	printTunnels(ts)
+	fmt.Println()
+	printClients(cs)
+	return nil
+}
+
+func tunnels(c *ctl.Client) error {
+	ts, err := c.Tunnels()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printJSON(ts)
+		return nil
+	}
+	printTunnels(ts)
+	return nil
+}
+
+func clients(c *ctl.Client) error {
+	cs, err := c.Clients()
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printJSON(cs)
+		return nil
+	}
+	printClients(cs)
+	return nil
+}
+
+func conns(c *ctl.Client, tunnel string) error {
+	views, err := c.Conns(tunnel)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printJSON(views)
+		return nil
+	}
+	w := newTable("CID", "TUNNEL", "CLIENT", "USER", "PROTO", "UP", "DOWN", "AGE")
+	for _, v := range views {
+		row(w, v.CID, v.Tunnel, v.Client, v.UserAddr, v.Protocol, formatBytes(v.BytesUp), formatBytes(v.BytesDown),
+			time.Duration(v.AgeSeconds*float64(time.Second)).Round(time.Second))
+	}
+	return w.Flush()
+}
+
+func stats(c *ctl.Client, name string) error {
+	v, err := c.Tunnel(name)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printJSON(v)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	row(w, "name:", v.Name)
+	row(w, "addr:", v.Addr+" ("+v.Protocol+")")
+	row(w, "balance:", v.Balance)
+	row(w, "enabled:", v.Enabled)
+	row(w, "clients:", strings.Join(v.Clients, ", "))
+	row(w, "active conns:", v.ActiveConns)
+	row(w, "accepted conns:", v.AcceptedConns)
+	row(w, "rejected conns:", v.RejectedConns)
+	row(w, "bytes up:", fmt.Sprintf("%s (%d)", formatBytes(v.BytesUp), v.BytesUp))
+	row(w, "bytes down:", fmt.Sprintf("%s (%d)", formatBytes(v.BytesDown), v.BytesDown))
+	row(w, "frames in:", v.FramesIn)
+	row(w, "frames out:", v.FramesOut)
+	return w.Flush()
+}
+
+func events(c *ctl.Client, args []string) error {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	n := fs.Int("n", 20, i18n.T("输出最近的事件数量"))
+	follow := fs.Bool("f", false, i18n.T("持续输出新事件"))
+	fs.Parse(args)
+
+	if *follow {
+		return c.FollowEvents(*n, func(e server.Event) error {
+			printEvent(e)
+			return nil
+		})
+	}
+	es, err := c.Events(*n)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		printJSON(es)
+		return nil
+	}
+	for _, e := range es {
+		printEvent(e)
+	}
+	return nil
+}
+
+func reload(c *ctl.Client) error {
+	r, err := c.Reload()
+	if err != nil {
+		return err
+	}
+	printResult(r, fmt.Sprintf("added: %s\nremoved: %s\nupdated: %s\nrestarted: %s\nunchanged: %s",
+		strings.Join(r.Added, ", "), strings.Join(r.Removed, ", "), strings.Join(r.Updated, ", "), strings.Join(r.Restarted, ", "), strings.Join(r.Unchanged, ", ")))
+	return nil
+}
+
+// eachID 解析 id 并依次执行 fn，遇到错误时返回
+func eachID(args []string, fn func(id uint32) error) error {
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			return i18n.Errorf("无效的id：%s", arg)
+		}
+		if err := fn(uint32(id)); err != nil {
+			return err
+		}
+	}
+	printResult(map[string]string{"result": "ok"}, "ok")
+	return nil
+}
+
+func printTunnels(ts []server.TunnelView) {
+	w := newTable("NAME", "ADDR", "PROTO", "BALANCE", "COMPRESS", "ENABLED", "CLIENTS", "CONNS", "ACCEPTED", "REJECTED", "UP", "DOWN")
+	for _, t := range ts {
+		row(w, t.Name, t.Addr, t.Protocol, t.Balance, cmp.Or(t.Compression, common.CompressionNone), t.Enabled, len(t.Clients), t.ActiveConns, t.AcceptedConns, t.RejectedConns,
+			formatBytes(t.BytesUp), formatBytes(t.BytesDown))
+	}
+	w.Flush()
+}
+
+func printClients(cs []server.ClientView) {
+	w := newTable("ID", "TUNNEL", "NAME", "ADDR", "VERSION", "ENCRYPTED", "LINKS", "POOL", "HEALTHY", "CONNS", "RTT", "UP", "DOWN", "UPTIME")
+	for _, c := range cs {
+		row(w, c.ID, c.Tunnel, c.Name, c.Addr, c.Version, c.Encrypted, c.Links, c.Pooled, c.Healthy, c.ActiveConns, fmt.Sprintf("%.1fms", c.RTTMillis),
+			formatBytes(c.BytesUp), formatBytes(c.BytesDown), time.Since(c.ConnectedAt).Round(time.Second))
+	}
+	w.Flush()
+}
+
+func printEvent(e server.Event) {
+	if jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(e)
+		return
+	}
+	fields := []string{e.Time.Local().Format("2006-01-02 15:04:05"), e.Type}
+	if e.Tunnel != "" {
+		fields = append(fields, "tunnel="+e.Tunnel)
+	}
+	if e.Client != "" {
+		fields = append(fields, "client="+e.Client)
+	}
+	if e.CID != 0 {
+		fields = append(fields, fmt.Sprintf("cid=%d", e.CID))
+	}
+	fmt.Println(strings.Join(append(fields, e.Message), " "))
+}
+
+// printResult 以 JSON 或文本格式输出操作结果
+func printResult(v any, text string) {
+	if jsonOutput {
+		printJSON(v)
+		return
+	}
+	fmt.Println(text)
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func newTable(header ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	return w
+}
+
+func row(w *tabwriter.Writer, values ...any) {
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i] = fmt.Sprint(v)
+	}
+	fmt.Fprintln(w, strings.Join(fields, "\t"))
+}
+
+// formatBytes 以 1024 为进制格式化字节数
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func envOr(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+func fatalUsage(message string) {
+	fmt.Fprintln(os.Stderr, i18n.Sprintf("srpctl：%s", message))
+	flag.Usage()
+	os.Exit(2)
+}
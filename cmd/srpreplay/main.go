@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"srp/internal/common"
+	"srp/internal/record"
+	"srp/pkg/i18n"
+	"sync"
+	"time"
+)
+
+const usage = `用法：srpreplay [参数] <命令> <录制文件>
+
+命令：
+  dump     输出录制的协议帧
+  server   作为srp-server监听listen地址，srp-client连接后按录制的时间发送srp-server发出的帧，
+           并将srp-client发来的帧与录制的比较
+  client   作为srp-client连接server地址，按录制的时间发送srp-client发出的帧，
+           并将srp-server发来的帧与录制的比较
+
+心跳帧与时间有关，重放时不发送也不比较；重放的帧与录制不一致时以状态码1退出。
+
+参数：
+`
+
+var (
+	speed          float64
+	wait           time.Duration
+	comparePayload bool
+	verbose        bool
+)
+
+func main() {
+	// 先确定语言，使命令行参数的说明也使用对应的语言
+	if err := i18n.Init(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "srpreplay："+err.Error())
+		os.Exit(2)
+	}
+	listen := flag.String("listen", "127.0.0.1:6352", i18n.T("server命令监听的地址"))
+	server := flag.String("server", "127.0.0.1:6352", i18n.T("client命令连接的srp-server地址"))
+	password := flag.String("server-pwd", common.DefaultServerPasswd, i18n.T("client命令连接srp-server的密码，录制文件中不包含密码"))
+	flag.Float64Var(&speed, "speed", 1, i18n.T("重放速度的倍数，0表示不等待，尽快发送"))
+	flag.DurationVar(&wait, "wait", 3*time.Second, i18n.T("发送完所有帧后等待对端响应的时间"))
+	flag.BoolVar(&comparePayload, "compare-payload", true, i18n.T("比较TypeForwarding的有效载荷，服务的响应含有时间等变化的内容时可关闭"))
+	flag.BoolVar(&verbose, "v", false, i18n.T("输出有效载荷"))
+	flag.String("lang", i18n.Lang(), i18n.Sprintf("界面语言，支持：%s，默认根据环境变量LANG选择", i18n.Join(i18n.Langs)))
+	versionInfo := flag.Bool("version", false, i18n.T("打印版本信息"))
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), i18n.T(usage))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *versionInfo {
+		fmt.Println(i18n.Sprintf("srpreplay，版本：%s", common.Version))
+		return
+	}
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	frames, err := record.ReadFile(flag.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+	var ok bool
+	switch flag.Arg(0) {
+	case "dump":
+		dump(frames)
+		return
+	case "server":
+		ok, err = replayServer(*listen, frames)
+	case "client":
+		ok, err = replayClient(*server, *password, frames)
+	default:
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("srpreplay：%s", i18n.Sprintf("未知的命令：%s", flag.Arg(0))))
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func dump(frames []record.Frame) {
+	for _, f := range frames {
+		printFrame(frames[0].Time, f)
+	}
+}
+
+// replayServer 作为 srp-server 重放录制，接受一个 srp-client 的连接后开始发送
+func replayServer(addr string, frames []record.Frame) (bool, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false, err
+	}
+	defer listener.Close()
+	fmt.Println(i18n.Sprintf("等待srp-client连接%s", addr))
+	conn, err := listener.Accept()
+	if err != nil {
+		return false, err
+	}
+	return replay(conn, frames, record.ServerToClient, nil), nil
+}
+
+// replayClient 作为 srp-client 重放录制，发送的 TypePing 使用 password 作为密码
+func replayClient(addr, password string, frames []record.Frame) (bool, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return false, err
+	}
+	return replay(conn, frames, record.ClientToServer, func(p common.Proto) common.Proto {
+		if p.Type != common.TypePing {
+			return p
+		}
+		ping := common.DecodePingPayload(p.Payload)
+		ping.Password = password
+		payload, _ := common.EncodePingPayload(ping)
+		return common.NewProto(p.Code, p.Type, p.CID, payload)
+	}), nil
+}
+
+// replay 按录制的时间发送方向为 send 的帧，同时接收对端的帧，发送完成并等待 wait 后与录制的帧比较，
+// rewrite 不为 nil 时用于在发送前修改帧
+func replay(conn net.Conn, frames []record.Frame, send record.Direction, rewrite func(common.Proto) common.Proto) bool {
+	defer conn.Close()
+	var (
+		mu       sync.Mutex
+		received []common.Proto
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		reader := bufio.NewReader(conn)
+		for {
+			var p common.Proto
+			if err := p.DecodeProto(reader); err != nil {
+				return
+			}
+			printFrame(time.Time{}, record.Frame{Time: time.Now(), Dir: send.Reverse(), Proto: p})
+			mu.Lock()
+			received = append(received, p)
+			mu.Unlock()
+		}
+	}()
+
+	var expected []common.Proto
+	start := time.Now()
+	for _, f := range frames {
+		if isHeartbeat(f.Proto) {
+			continue
+		}
+		if f.Dir != send {
+			expected = append(expected, f.Proto)
+			continue
+		}
+		if speed > 0 {
+			offset := time.Duration(float64(f.Time.Sub(frames[0].Time)) / speed)
+			time.Sleep(time.Until(start.Add(offset)))
+		}
+		p := f.Proto
+		if rewrite != nil {
+			p = rewrite(p)
+		}
+		b, err := p.EncodeProto()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("srpreplay：%s", err))
+			return false
+		}
+		if _, err := conn.Write(b); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("srpreplay：%s", err))
+			break
+		}
+		printFrame(time.Time{}, record.Frame{Time: time.Now(), Dir: send, Proto: p})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return compare(expected, received)
+}
+
+// compare 比较对端发来的帧与录制的帧，状态码、类型、cid 和有效载荷长度需一致，
+// comparePayload 为 true 时 TypeForwarding 的有效载荷也需一致
+func compare(expected, received []common.Proto) bool {
+	var filtered []common.Proto
+	for _, p := range received {
+		if !isHeartbeat(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	for i := 0; i < len(expected) && i < len(filtered); i++ {
+		e, r := expected[i], filtered[i]
+		if e.Code != r.Code || e.Type != r.Type || e.CID != r.CID ||
+			(e.Type == common.TypeForwarding && e.PayloadLen != r.PayloadLen) ||
+			(e.Type == common.TypeForwarding && comparePayload && string(e.Payload) != string(r.Payload)) {
+			fmt.Println(i18n.Sprintf("第%d帧不一致，录制：%s，收到：%s", i+1, summary(e), summary(r)))
+			return false
+		}
+	}
+	if len(expected) != len(filtered) {
+		fmt.Println(i18n.Sprintf("帧数量不一致，录制：%d，收到：%d", len(expected), len(filtered)))
+		return false
+	}
+	fmt.Println(i18n.Sprintf("重放完成，%d帧一致", len(expected)))
+	return true
+}
+
+func isHeartbeat(p common.Proto) bool {
+	return p.Type == common.TypeHeartbeat || p.Type == common.TypeHeartbeatAck
+}
+
+// printFrame 输出一帧，start 不为零时输出相对 start 的时间
+func printFrame(start time.Time, f record.Frame) {
+	ts := f.Time.Format("15:04:05.000")
+	if !start.IsZero() {
+		ts = fmt.Sprintf("+%.3fs", f.Time.Sub(start).Seconds())
+	}
+	fmt.Printf("%s %s %s\n", ts, f.Dir, summary(f.Proto))
+	if verbose && len(f.Proto.Payload) > 0 {
+		fmt.Printf("    %q\n", f.Proto.Payload)
+	}
+}
+
+func summary(p common.Proto) string {
+	s := fmt.Sprintf("%s %s cid=%d len=%d", p.TypeName(), p.CodeName(), p.CID, p.PayloadLen)
+	if p.Compressed {
+		s += " compressed"
+	}
+	return s
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, i18n.Sprintf("srpreplay：%s", err))
+	os.Exit(1)
+}
@@ -1 +1,3 @@
 module srp
+
+go 1.24
@@ -2,13 +2,18 @@ package client
 
 import (
 	"bufio"
+	"crypto/rand"
 	"errors"
-	"fmt"
-	"log"
+	"io"
 	"net"
 	"srp/internal/common"
+	"srp/pkg/i18n"
 	"srp/pkg/logger"
+	"srp/pkg/ratelimit"
+	"srp/pkg/secure"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,21 +27,61 @@ type Config struct {
 	ServerPassword string
 	ServerProtocol string // 用户和 srp-server 通信的协议，也为 srp-client 和 service 的通信协议
 
-	LogLevel int
+	Tunnel string // 注册到 srp-server 的隧道名称
+	Name   string // srp-client 名称，同一隧道的多个 srp-client 名称不能相同
+
+	HealthInterval time.Duration // 健康检查间隔
+	HealthTimeout  time.Duration // 健康检查超时时间
+	HealthPath     string        // HTTP 健康检查的请求路径
+
+	MaxPayloadSize uint32        // 能够接收的协议帧有效载荷最大长度，为 0 时使用 common.DefaultMaxPayloadSize
+	ReadTimeout    time.Duration // 控制连接的读取超时时间，只在双方都支持心跳时生效，为 0 时不超时
+	FlushDelay     time.Duration // 控制连接合并写入前等待更多帧的时间，为 0 时不等待
+	Encrypt        bool          // 是否加密与 srp-server 之间的控制连接
+	Obfuscate      bool          // 是否以混淆模式连接 srp-server，需同时设置 Encrypt
+	Conns          int           // 希望使用的控制连接数，srp-server 不支持时只使用一条
+	Direct         bool          // 是否为每个 TCP 用户连接建立直连数据连接，srp-server 不支持时经由控制连接转发
+	Pool           int           // 保持的空闲预建数据连接数，为 0 时不预先建立
+	PoolService    bool          // 是否为每条预建数据连接预先建立服务连接
+
+	ConnLimit ratelimit.Limit // 每个用户连接的下行限速，由 srp-server 下发
 }
 
 type Client struct {
 	Config
 
-	ServerConn    net.Conn
-	UserConnIDMap map[uint32]net.Conn // map of User Connection ID to Connection
+	ServerConn    net.Conn                 // 第一条控制连接
+	Links         []*Link                  // 与 srp-server 之间的所有控制连接，第一条为 ServerConn，建立后不再变化
+	Session       string                   // 与 srp-server 的会话标识，其余控制连接和直连数据连接以其加入会话
+	UserConnIDMap map[uint32]net.Conn      // map of User Connection ID to Connection
+	pausedConns   map[uint32]chan struct{} // 被 srp-server 暂停的用户连接，恢复或关闭时关闭对应的 chan，由 RWMu 保护
+
+	RWMu *sync.RWMutex
+
+	Stats        common.TrafficStats
+	DialFailures uint64 // 无法连接服务的次数
 
-	BufferPool sync.Pool // 缓冲区复用
-	RWMu       *sync.RWMutex
+	Version int               // 与 srp-server 协商的协议版本
+	Caps    common.Capability // 与 srp-server 都支持的功能
+
+	ServerMaxPayload uint32 // srp-server 能够接收的有效载荷最大长度，旧版本 srp-server 不声明，为 0
+	Compression      string // 双方发送 TypeForwarding 时使用的压缩算法，由 srp-server 根据隧道配置决定，为空时不压缩
+
+	rtt       int64 // 最近一次心跳测得的控制连接往返时延，单位纳秒
+	unhealthy int32 // 最近一次健康检查失败时为 1
 
 	// 处理 SRP 客户端与服务之间连接的函数
 	// 在运行时动态根据命令行参数被赋值
 	HandleServerData func(data common.Proto)
+	// 检查服务健康状态的函数，为 nil 时不进行健康检查
+	CheckHealth func() error
+}
+
+// Link 为与 srp-server 之间的一条控制连接
+type Link struct {
+	Conn   net.Conn
+	Reader *bufio.Reader       // 读取 Conn，包含握手时已经读入缓冲区的帧
+	Writer *common.FrameWriter // 串行写入 Conn，所有经由该连接发往 srp-server 的帧都由 Writer 发送
 }
 
 func (c *Client) AddUserConn(cid uint32, conn net.Conn) {
@@ -58,6 +103,47 @@ func (c *Client) CloseUserConn(cid uint32) {
 		conn.Close()
 		delete(c.UserConnIDMap, cid)
 	}
+	c.resumeUserConn(cid)
+}
+
+// PauseUserConn 暂停读取 cid 对应的服务连接，srp-server 发往该用户连接的数据积压时发送 TypePause
+func (c *Client) PauseUserConn(cid uint32) {
+	c.RWMu.Lock()
+	defer c.RWMu.Unlock()
+	if _, ok := c.UserConnIDMap[cid]; !ok {
+		return
+	}
+	if c.pausedConns == nil {
+		c.pausedConns = make(map[uint32]chan struct{})
+	}
+	if _, ok := c.pausedConns[cid]; !ok {
+		c.pausedConns[cid] = make(chan struct{})
+	}
+}
+
+// ResumeUserConn 恢复读取 cid 对应的服务连接
+func (c *Client) ResumeUserConn(cid uint32) {
+	c.RWMu.Lock()
+	defer c.RWMu.Unlock()
+	c.resumeUserConn(cid)
+}
+
+// resumeUserConn 调用者需持有写锁
+func (c *Client) resumeUserConn(cid uint32) {
+	if ch, ok := c.pausedConns[cid]; ok {
+		close(ch)
+		delete(c.pausedConns, cid)
+	}
+}
+
+// waitResumed 在 cid 被暂停时等待恢复或连接关闭
+func (c *Client) waitResumed(cid uint32) {
+	c.RWMu.RLock()
+	ch := c.pausedConns[cid]
+	c.RWMu.RUnlock()
+	if ch != nil {
+		<-ch
+	}
 }
 
 func (c *Client) CloseAllServiceConn() {
@@ -67,90 +153,357 @@ func (c *Client) CloseAllServiceConn() {
 		m.Close()
 	}
 	c.UserConnIDMap = make(map[uint32]net.Conn)
+	for cid := range c.pausedConns {
+		c.resumeUserConn(cid)
+	}
 }
 
 func (c *Client) CloseServerConn() {
 	c.RWMu.Lock()
 	defer c.RWMu.Unlock()
-	if c.ServerConn != nil {
-		c.ServerConn.Close()
+	for _, l := range c.Links {
+		l.Conn.Close()
 	}
 }
 
+// EstablishServerConn 与 srp-server 建立会话，双方都支持时再建立其余的控制连接加入会话，失败时退出
 func (c *Client) EstablishServerConn() {
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", c.ServerIP, c.ServerPort))
+	c.Session = rand.Text()
+	conns := max(c.Conns, 1)
+	link, pong, err := c.dialServer(common.PingPayload{Session: c.Session, Conns: conns})
 	if err != nil {
-		log.Fatal("与srp-server建立连接失败，" + err.Error())
+		logger.Fatal("与srp-server建立连接失败", "err", err)
+	}
+	c.ConnLimit = pong.ConnLimit
+	// srp-server 选择的版本需在本端支持的范围内，旧版本 srp-server 不携带版本和功能
+	if c.Version, err = common.NegotiateVersion(pong.Version, pong.Version); err != nil {
+		link.Conn.Close()
+		logger.Fatal("与srp-server建立连接失败", "err", err)
+	}
+	c.Caps = pong.Capabilities & common.Capabilities
+	c.ServerMaxPayload = pong.MaxPayload
+	c.Compression = pong.Compression
+	if c.Compression != "" && c.Compression != common.CompressionDeflate {
+		link.Conn.Close()
+		logger.Fatal("与srp-server建立连接失败", "err", i18n.Sprintf("不支持的压缩算法：%s", c.Compression))
 	}
 
-	// 发送密码
-	data := common.NewProto(common.CodeSuccess, common.TypePing, 0, []byte(c.ServerPassword))
-	dataByte, err := data.EncodeProto()
+	// 添加连接
+	c.ServerConn = link.Conn
+	c.Links = []*Link{link}
+	// 控制连接数由 srp-server 决定，可能少于要求的数量
+	if conns > 1 && !c.Caps.Has(common.CapMultiConn) {
+		logger.Warn("srp-server不支持多条控制连接，只使用一条连接")
+	}
+	for i := 1; i < pong.Conns && c.Caps.Has(common.CapMultiConn); i++ {
+		l, _, err := c.dialServer(common.PingPayload{Session: c.Session, Link: i})
+		if err != nil {
+			c.CloseServerConn()
+			logger.Fatal("与srp-server建立连接失败", "link", i, "err", err)
+		}
+		c.Links = append(c.Links, l)
+	}
+	for _, l := range c.Links {
+		l.Writer = common.NewFrameWriter(l.Conn, c.FlushDelay)
+	}
+	if c.Direct && !c.Caps.Has(common.CapDirect) {
+		logger.Warn("srp-server不支持直连数据连接，用户连接的数据经由控制连接转发")
+	}
+	logger.Info("成功与srp-server建立连接", "tunnel", c.Tunnel, "client", c.Name, "version", c.Version, "capabilities", c.Caps, "compression", c.Compression, "encrypted", c.Encrypt, "conns", len(c.Links))
+}
+
+// dialServer 建立一条连接并完成验证，返回该连接和 srp-server 的响应，返回的 Link 未设置 Writer。
+// ping 只需填写会话相关的字段，其余字段由 dialServer 填写
+func (c *Client) dialServer(ping common.PingPayload) (*Link, common.PongPayload, error) {
+	conn, err := net.Dial("tcp", net.JoinHostPort(c.ServerIP, strconv.Itoa(c.ServerPort)))
+	if err != nil {
+		return nil, common.PongPayload{}, err
+	}
+	(conn.(*net.TCPConn)).SetKeepAlive(true)
+	reader := bufio.NewReader(conn)
+	// 加密时先交换密钥，之后的数据均经过加密
+	if c.Obfuscate || c.Encrypt {
+		handshake := c.keyExchange
+		if c.Obfuscate {
+			handshake = c.obfsHandshake
+		}
+		sc, sr, err := handshake(conn, reader)
+		if err != nil {
+			conn.Close()
+			return nil, common.PongPayload{}, err
+		}
+		conn, reader = sc, sr
+	}
+
+	// 发送密码和注册的隧道
+	ping.Password = c.ServerPassword
+	ping.Tunnel = c.Tunnel
+	ping.Name = c.Name
+	ping.Service = net.JoinHostPort(c.ServiceIP, strconv.Itoa(c.ServicePort))
+	ping.Version = common.ProtocolVersion
+	ping.MinVersion = common.MinProtocolVersion
+	ping.Capabilities = common.Capabilities
+	ping.MaxPayload = c.maxPayloadSize()
+	payload, err := common.EncodePingPayload(ping)
 	if err != nil {
-		log.Fatal("与srp-server建立连接失败，无法构造数据：" + err.Error())
+		conn.Close()
+		return nil, common.PongPayload{}, i18n.Errorf("无法构造数据：%w", err)
 	}
-	if _, err = conn.Write(dataByte); err != nil {
+	data := common.NewProto(common.CodeSuccess, common.TypePing, 0, payload)
+	if _, err = conn.Write(data.AppendProto(nil)); err != nil {
 		conn.Close()
-		log.Fatal("与srp-server建立连接失败：" + err.Error())
+		return nil, common.PongPayload{}, err
 	}
-	logger.LogWithLevel(c.LogLevel, 2, "已向srp-server发送验证信息，等待响应")
+	logger.Debug("已向srp-server发送验证信息，等待响应", "link", ping.Link, "cid", ping.DataCID)
 
 	// 在 srp-server 在处理连接或已存在连接时，主动退出
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	reader := bufio.NewReader(conn)
-	if err = data.DecodeProto(reader); err != nil {
+	if err = data.DecodeProtoLimit(reader, common.MaxHandshakePayloadSize); err != nil {
 		conn.Close()
 		// 判断是否超时
 		var netErr net.Error
 		if errors.As(err, &netErr) && netErr.Timeout() {
-			log.Fatal("连接超时，请检查必要信息，在稍后重试")
-		} else {
-			log.Fatal("与srp-server建立连接失败：" + err.Error())
+			err = i18n.Errorf("连接超时，请检查必要信息，在稍后重试")
+		} else if c.Encrypt && errors.Is(err, io.EOF) {
+			// 密码错误时 srp-server 无法解密验证信息，直接断开连接
+			err = i18n.Errorf("请检查连接密码：%w", err)
 		}
+		return nil, common.PongPayload{}, err
 	}
 
 	// 取消过期时长
 	conn.SetReadDeadline(time.Time{})
 	if data.Code != common.CodeSuccess {
 		conn.Close()
-		log.Fatal("与srp-server建立连接失败，%s" + string(data.Payload))
+		return nil, common.PongPayload{}, errors.New(string(data.Payload))
 	}
+	return &Link{Conn: conn, Reader: reader}, common.DecodePongPayload(data.Payload), nil
+}
 
-	// 添加连接
-	(conn.(*net.TCPConn)).SetKeepAlive(true)
-	c.ServerConn = conn
-	logger.LogWithLevel(c.LogLevel, 1, "成功与srp-server建立连接")
+// keyExchange 与 srp-server 交换临时公钥，返回加密的连接和读取该连接的 Reader，reader 为已经用于读取 conn 的 Reader
+func (c *Client) keyExchange(conn net.Conn, reader *bufio.Reader) (net.Conn, *bufio.Reader, error) {
+	key, err := secure.GenerateKey(c.ServerPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := common.NewProto(common.CodeSuccess, common.TypeKeyExchange, 0, key.PublicKey())
+	if _, err = conn.Write(data.AppendProto(nil)); err != nil {
+		return nil, nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	// 旧版本 srp-server 不认识 TypeKeyExchange，会直接断开连接
+	if err = data.DecodeProtoLimit(reader, common.MaxHandshakePayloadSize); err != nil {
+		return nil, nil, i18n.Errorf("srp-server可能不支持加密：%w", err)
+	}
+	if data.Type != common.TypeKeyExchange {
+		return nil, nil, i18n.Errorf("srp-server不支持加密")
+	}
+	keys, err := key.DeriveKeys(data.Payload, c.ServerPassword, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc := secure.NewConn(conn, reader, keys)
+	return sc, bufio.NewReader(sc), nil
 }
 
-// SendDataToServer 向 srp-server 发送数据
-func (c *Client) SendDataToServer(p common.Proto) error {
-	if c.ServerConn == nil {
-		return fmt.Errorf("未建立和srp-server的连接")
+// obfsHandshake 与 srp-server 完成混淆握手，返回混淆模式的加密连接和读取该连接的 Reader，reader 为已经用于读取 conn 的 Reader
+func (c *Client) obfsHandshake(conn net.Conn, reader *bufio.Reader) (net.Conn, *bufio.Reader, error) {
+	key, err := secure.GenerateObfsKey(c.ServerPassword)
+	if err != nil {
+		return nil, nil, err
 	}
-	dataByte, err := p.EncodeProto()
+	nonce, err := secure.WriteClientHello(conn, key, c.ServerPassword)
 	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	// srp-server 未使用混淆模式时不回应，超时后断开连接，密码错误时握手中的记录解密失败
+	peer, err := secure.ReadServerHello(reader, c.ServerPassword, nonce)
+	if err != nil {
+		return nil, nil, i18n.Errorf("请检查连接密码以及srp-server是否使用-obfs：%w", err)
+	}
+	keys, err := key.DeriveKeys(peer, c.ServerPassword, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc := secure.NewObfsConn(conn, reader, keys)
+	if err := sc.ReadHelloRecord(); err != nil {
+		return nil, nil, i18n.Errorf("请检查连接密码以及srp-server是否使用-obfs：%w", err)
+	}
+	return sc, bufio.NewReader(sc), nil
+}
+
+// SendDataToServer 向 srp-server 发送数据，经由承载 p.CID 的控制连接发送
+func (c *Client) SendDataToServer(p common.Proto) error {
+	if len(c.Links) == 0 {
+		return i18n.Errorf("未建立和srp-server的连接")
+	}
+	return c.sendDataToLink(c.Links[common.LinkIndex(p.CID, len(c.Links))], p)
+}
+
+// sendDataToLink 经由控制连接 link 向 srp-server 发送数据
+func (c *Client) sendDataToLink(link *Link, p common.Proto) error {
+	if c.Compression != "" {
+		if cp := common.CompressProto(p); cp.Compressed {
+			defer cp.Release()
+			p = cp
+		}
+	}
+	if err := p.CheckPayloadSize(c.ServerMaxPayload); err != nil {
+		return err
+	}
+	if err := link.Writer.Send(p); err != nil {
 		return err
 	}
-	_, err = c.ServerConn.Write(dataByte)
-	return err
+	c.Stats.AddFrameOut()
+	return nil
+}
+
+// ReadServerFrame 从控制连接 link 读取一帧，有效载荷超过上限或超过 ReadTimeout 未收到数据时返回错误，
+// 双方都支持心跳时 srp-server 至少每个心跳间隔在每条控制连接上发送一帧，否则不设置读取超时，
+// 压缩的帧在返回前解压，有效载荷可能来自缓冲池，使用完后应调用 Release
+func (c *Client) ReadServerFrame(link *Link, p *common.Proto) error {
+	if c.ReadTimeout > 0 && c.Caps.Has(common.CapHeartbeat) {
+		link.Conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+	}
+	if err := p.ReadProto(link.Reader, c.maxPayloadSize()); err != nil {
+		return err
+	}
+	if p.Compressed {
+		d, err := common.DecompressProto(*p)
+		p.Release()
+		if err != nil {
+			return err
+		}
+		*p = d
+	}
+	return nil
+}
+
+// maxPayloadSize 返回能够接收的有效载荷最大长度
+func (c *Client) maxPayloadSize() uint32 {
+	if c.MaxPayloadSize == 0 {
+		return common.DefaultMaxPayloadSize
+	}
+	return c.MaxPayloadSize
+}
+
+// SendHeartbeat 定期向 srp-server 的每条控制连接发送心跳以测量往返时延
+func (c *Client) SendHeartbeat() {
+	for {
+		time.Sleep(common.HeartbeatInterval)
+		for _, l := range c.Links {
+			if err := c.sendDataToLink(l, common.NewHeartbeat()); err != nil {
+				logger.Warn("无法向srp-server发送心跳", "err", err)
+			}
+		}
+	}
+}
+
+// HandleHeartbeat 响应 srp-server 的心跳请求，或根据心跳响应记录往返时延
+func (c *Client) HandleHeartbeat(link *Link, data common.Proto) {
+	if data.Type == common.TypeHeartbeat {
+		ack := common.NewProto(common.CodeSuccess, common.TypeHeartbeatAck, 0, data.Payload)
+		if err := c.sendDataToLink(link, ack); err != nil {
+			logger.Warn("无法响应srp-server的心跳", "err", err)
+		}
+		return
+	}
+	if rtt, ok := common.HeartbeatRTT(data); ok {
+		atomic.StoreInt64(&c.rtt, int64(rtt))
+		logger.Trace("srp-server的往返时延", "rtt", rtt)
+	}
+}
+
+// RTT 返回最近一次心跳测得的控制连接往返时延
+func (c *Client) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt))
+}
+
+// serveDirect 为用户连接建立直连数据连接，在其与服务连接 conn 之间直接转发原始字节，
+// 无法建立直连数据连接时拒绝该用户连接
+func (c *Client) serveDirect(cid uint32, conn net.Conn) {
+	link, _, err := c.dialServer(common.PingPayload{Session: c.Session, DataCID: cid})
+	if err != nil {
+		conn.Close()
+		logger.Warn("拒绝用户连接，无法建立直连数据连接", "cid", cid, "err", err)
+		dataErr := common.NewProto(common.CodeForbidden, common.TypeRejectConn, cid, []byte(i18n.Sprintf("无法建立直连数据连接：%s", err)))
+		if err := c.SendDataToServer(dataErr); err != nil {
+			logger.Warn("无法向srp-server发送数据", "cid", cid, "err", err)
+		}
+		return
+	}
+	logger.Debug("建立直连数据连接", "cid", cid, "local_addr", conn.LocalAddr().String(), "service_addr", conn.RemoteAddr().String())
+	c.spliceDirect(cid, link, conn)
+}
+
+// spliceDirect 在数据连接 link 和服务连接 conn 之间转发原始字节，任一方向断开后关闭两个连接
+func (c *Client) spliceDirect(cid uint32, link *Link, conn net.Conn) {
+	c.AddUserConn(cid, conn)
+	defer c.CloseUserConn(cid)
+	defer link.Conn.Close()
+
+	// srp-server 到服务，握手时已经读入缓冲区的数据在 Reader 中
+	go func() {
+		defer c.CloseUserConn(cid)
+		buf := make([]byte, common.MaxBufferSize)
+		for {
+			n, err := link.Reader.Read(buf)
+			if n > 0 {
+				c.Stats.AddUp(n)
+				if _, err := conn.Write(buf[:n]); err != nil {
+					logger.Debug("无法转发数据到服务", "cid", cid, "err", err)
+					return
+				}
+			}
+			if err != nil {
+				logger.Debug("直连数据连接断开", "cid", cid, "err", err)
+				return
+			}
+		}
+	}()
+
+	// 服务到 srp-server，按用户连接的下行限速等待
+	bucket := c.ConnLimit.NewBucket()
+	buf := make([]byte, common.MaxBufferSize)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			c.Stats.AddDown(n)
+			bucket.Wait(n)
+			if _, err := link.Conn.Write(buf[:n]); err != nil {
+				logger.Debug("无法向srp-server发送数据", "cid", cid, "err", err)
+				return
+			}
+		}
+		if err != nil {
+			logger.Debug("用户连接的服务连接断开", "cid", cid, "err", err)
+			return
+		}
+	}
 }
 
 // HandleServerDataTCP 处理 TCP 数据
 func (c *Client) HandleServerDataTCP(data common.Proto) {
 	cid := data.CID
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", c.ServiceIP, c.ServicePort))
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.ServiceIP, strconv.Itoa(c.ServicePort)), common.NewConnTimeout)
 	if err != nil {
-		logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("拒绝用户连接(cid：%d)，无法和服务建立连接：%s", cid, err))
-		dataErr := common.NewProto(common.CodeForbidden, common.TypeRejectConn, cid, []byte(err.Error()))
+		atomic.AddUint64(&c.DialFailures, 1)
+		logger.Warn("拒绝用户连接，无法和服务建立连接", "cid", cid, "err", err)
+		dataErr := common.NewProto(common.CodeForbidden, common.TypeRejectConn, cid, []byte(i18n.Sprintf("无法和服务建立连接：%s", err)))
 		if err := c.SendDataToServer(dataErr); err != nil {
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向srp-server发送数据，%s", err))
+			logger.Warn("无法向srp-server发送数据", "cid", cid, "err", err)
 		}
 		return
+	} else if c.Direct && c.Caps.Has(common.CapDirect) {
+		(conn.(*net.TCPConn)).SetKeepAlive(true)
+		c.serveDirect(cid, conn)
+		return
 	} else {
 		dataOk := common.NewProto(common.CodeSuccess, common.TypeAcceptConn, cid, []byte{})
 		if err := c.SendDataToServer(dataOk); err != nil {
 			conn.Close()
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向srp-server发送数据，%s", err))
+			logger.Warn("无法向srp-server发送数据", "cid", cid, "err", err)
 			return
 		}
 	}
@@ -159,21 +512,26 @@ func (c *Client) HandleServerDataTCP(data common.Proto) {
 	(conn.(*net.TCPConn)).SetKeepAlive(true)
 	c.AddUserConn(cid, conn)
 	defer c.CloseUserConn(cid)
-	logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("建立连接(cid：%d)：%s->%s", cid, conn.LocalAddr(), conn.RemoteAddr()))
+	logger.Debug("建立连接", "cid", cid, "local_addr", conn.LocalAddr().String(), "service_addr", conn.RemoteAddr().String())
 
-	buffer := c.BufferPool.Get().([]byte)
-	defer c.BufferPool.Put(buffer)
+	bucket := c.ConnLimit.NewBucket()
 	// 阻塞在获取 service 消息处，获得消息后立刻包装发送
 	for {
-		n, err := conn.Read(buffer)
+		// srp-server 暂停该连接时不再读取服务的数据
+		c.waitResumed(cid)
+		data := common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, nil)
+		n, err := data.ReadPayload(conn)
 		if err != nil {
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("用户连接(cid：%d)的服务连接断开，%s", cid, err))
+			logger.Debug("用户连接的服务连接断开", "cid", cid, "err", err)
 			c.SendDataToServer(common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error())))
 			return
 		}
-		// 只传输读取的所有数据，而不是原来的 buffer
-		if err = c.SendDataToServer(common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, buffer[:n])); err != nil {
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向srp-server发送用户(cid:%d)的数据，%s", cid, err))
+		c.Stats.AddDown(n)
+		bucket.Wait(n)
+		err = c.SendDataToServer(data)
+		data.Release()
+		if err != nil {
+			logger.Warn("无法向srp-server发送数据", "cid", cid, "bytes", n, "err", err)
 		}
 	}
 }
@@ -182,25 +540,26 @@ func (c *Client) HandleServerDataTCP(data common.Proto) {
 func (c *Client) HandleServerDataUDP(data common.Proto) {
 	// 初始化
 	cid := data.CID
-	clientAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", c.ServiceIP, c.ServicePort))
+	clientAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(c.ServiceIP, strconv.Itoa(c.ServicePort)))
 	if err != nil {
 		dataErr := common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error()))
 		if err := c.SendDataToServer(dataErr); err != nil {
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向srp-server发送数据，%s", err))
+			logger.Warn("无法向srp-server发送数据", "cid", cid, "err", err)
 			return
 		}
-		logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向服务发起UDP连接，%s", err))
+		logger.Warn("无法向服务发起UDP连接", "cid", cid, "err", err)
 		return
 	}
 
 	conn, err := net.DialUDP("udp", nil, clientAddr)
 	if err != nil {
+		atomic.AddUint64(&c.DialFailures, 1)
 		dataErr := common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error()))
 		if err := c.SendDataToServer(dataErr); err != nil {
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向srp-server发送数据，%s", err))
+			logger.Warn("无法向srp-server发送数据", "cid", cid, "err", err)
 			return
 		}
-		logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向服务发起UDP连接，%s", err))
+		logger.Warn("无法向服务发起UDP连接", "cid", cid, "err", err)
 		return
 	}
 
@@ -209,7 +568,7 @@ func (c *Client) HandleServerDataUDP(data common.Proto) {
 	// 发送连接请求响应
 	err = c.SendDataToServer(common.NewProto(common.CodeSuccess, common.TypeAcceptConn, cid, []byte{}))
 	if err != nil {
-		logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向srp-server发送数据：%s", err))
+		logger.Warn("无法向srp-server发送数据", "cid", cid, "err", err)
 		conn.Close()
 		return
 	}
@@ -217,20 +576,25 @@ func (c *Client) HandleServerDataUDP(data common.Proto) {
 	// 记录映射
 	c.AddUserConn(cid, conn)
 	defer c.CloseUserConn(cid)
-	logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("建立连接(cid：%d)：srp-client->%s", cid, conn.RemoteAddr()))
+	logger.Debug("建立连接", "cid", cid, "service_addr", conn.RemoteAddr().String())
 
-	buffer := c.BufferPool.Get().([]byte)
-	defer c.BufferPool.Put(buffer)
+	bucket := c.ConnLimit.NewBucket()
 	for {
-		n, err := conn.Read(buffer)
+		// srp-server 暂停该连接时不再读取服务的数据
+		c.waitResumed(cid)
+		data := common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, nil)
+		n, err := data.ReadPayload(conn)
 		if err != nil {
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("用户连接(cid：%d)的服务连接断开，%s", cid, err))
+			logger.Debug("用户连接的服务连接断开", "cid", cid, "err", err)
 			c.SendDataToServer(common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error())))
 			return
 		}
-		// 只传输读取的所有数据，而不是原来的 buffer
-		if err = c.SendDataToServer(common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, buffer[:n])); err != nil {
-			logger.LogWithLevel(c.LogLevel, 2, fmt.Sprintf("无法向srp-server发送数据：%s", err))
+		c.Stats.AddDown(n)
+		bucket.Wait(n)
+		err = c.SendDataToServer(data)
+		data.Release()
+		if err != nil {
+			logger.Warn("无法向srp-server发送数据", "cid", cid, "bytes", n, "err", err)
 			continue
 		}
 	}
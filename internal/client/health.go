@@ -0,0 +1,81 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"srp/internal/common"
+	"srp/pkg/i18n"
+	"srp/pkg/logger"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// CheckHealthTCP 通过建立 TCP 连接检查服务是否可用
+func (c *Client) CheckHealthTCP() error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.ServiceIP, strconv.Itoa(c.ServicePort)), c.HealthTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// CheckHealthHTTP 通过 HTTP GET 请求检查服务是否可用，状态码小于 400 视为健康
+func (c *Client) CheckHealthHTTP() error {
+	httpClient := http.Client{
+		Timeout: c.HealthTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	url := "http://" + net.JoinHostPort(c.ServiceIP, strconv.Itoa(c.ServicePort)) + c.HealthPath
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return i18n.Errorf("HTTP状态码：%d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Healthy 返回最近一次健康检查的结果，未进行健康检查时总是健康的
+func (c *Client) Healthy() bool {
+	return atomic.LoadInt32(&c.unhealthy) == 0
+}
+
+func (c *Client) setHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&c.unhealthy, 0)
+	} else {
+		atomic.StoreInt32(&c.unhealthy, 1)
+	}
+}
+
+// RunHealthCheck 定期检查服务的健康状态，在状态变化时报告给 srp-server，
+// srp-server 不会向不健康的 srp-client 分配用户连接
+func (c *Client) RunHealthCheck() {
+	healthy, reported := true, false
+	ticker := time.NewTicker(c.HealthInterval)
+	defer ticker.Stop()
+	for {
+		err := c.CheckHealth()
+		if !reported || (err == nil) != healthy {
+			healthy, reported = err == nil, true
+			c.setHealthy(healthy)
+			data := common.NewProto(common.CodeSuccess, common.TypeHealth, 0, []byte(i18n.T("服务健康")))
+			if err != nil {
+				data = common.NewProto(common.CodeForbidden, common.TypeHealth, 0, []byte(err.Error()))
+				logger.Info("服务健康检查失败", "err", err)
+			} else {
+				logger.Info("服务健康检查通过")
+			}
+			if err := c.SendDataToServer(data); err != nil {
+				logger.Warn("无法向srp-server发送健康状态", "err", err)
+				reported = false
+			}
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"srp/internal/common"
+	"srp/pkg/metrics"
+	"sync/atomic"
+)
+
+// RegisterMetrics 注册 srp-client 的指标，指标在抓取时从当前状态计算
+func (c *Client) RegisterMetrics(r *metrics.Registry) {
+	labels := []string{"tunnel", c.Tunnel, "client", c.Name}
+	gauge := func(name, help string, value func() float64) {
+		r.Gauge(name, help, func() []metrics.Sample {
+			return []metrics.Sample{metrics.Value(value(), labels...)}
+		})
+	}
+	gauge("srp_client_connected", "是否已和srp-server建立连接，1为已连接", func() float64 {
+		c.RWMu.RLock()
+		defer c.RWMu.RUnlock()
+		if c.ServerConn != nil {
+			return 1
+		}
+		return 0
+	})
+	gauge("srp_client_active_conns", "活跃的用户连接（cid）数", func() float64 {
+		c.RWMu.RLock()
+		defer c.RWMu.RUnlock()
+		return float64(len(c.UserConnIDMap))
+	})
+	gauge("srp_client_udp_sessions", "活跃的UDP会话数", func() float64 {
+		if c.ServerProtocol != "udp" {
+			return 0
+		}
+		c.RWMu.RLock()
+		defer c.RWMu.RUnlock()
+		return float64(len(c.UserConnIDMap))
+	})
+	gauge("srp_client_rtt_seconds", "心跳测得的控制连接往返时延", func() float64 {
+		return c.RTT().Seconds()
+	})
+	gauge("srp_client_service_healthy", "最近一次健康检查的结果，1为健康", func() float64 {
+		if c.Healthy() {
+			return 1
+		}
+		return 0
+	})
+	r.Counter("srp_client_dial_failures_total", "无法连接被转发服务的次数", func() []metrics.Sample {
+		return []metrics.Sample{metrics.Value(float64(atomic.LoadUint64(&c.DialFailures)), labels...)}
+	})
+	r.Counter("srp_client_bytes_total", "转发的有效载荷字节数，up为user到服务，down为服务到user", func() []metrics.Sample {
+		st := c.Stats.Snapshot()
+		return []metrics.Sample{
+			metrics.Value(float64(st.BytesUp), "tunnel", c.Tunnel, "client", c.Name, "direction", "up"),
+			metrics.Value(float64(st.BytesDown), "tunnel", c.Tunnel, "client", c.Name, "direction", "down"),
+		}
+	})
+	r.Counter("srp_client_frames_total", "和srp-server之间收发的协议帧数", func() []metrics.Sample {
+		st := c.Stats.Snapshot()
+		return []metrics.Sample{
+			metrics.Value(float64(st.FramesIn), "tunnel", c.Tunnel, "client", c.Name, "direction", "in"),
+			metrics.Value(float64(st.FramesOut), "tunnel", c.Tunnel, "client", c.Name, "direction", "out"),
+		}
+	})
+	r.Gauge("srp_client_info", "srp-client版本信息", func() []metrics.Sample {
+		return []metrics.Sample{metrics.Value(1, "tunnel", c.Tunnel, "client", c.Name, "version", common.Version)}
+	})
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"net"
+	"srp/internal/common"
+	"srp/pkg/i18n"
+	"srp/pkg/logger"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// poolRetryInterval 为预建数据连接建立失败或异常断开后重试的间隔
+	poolRetryInterval = time.Second
+	// poolServiceRefresh 为预先建立的服务连接空闲后重新建立的时间，避免服务关闭空闲连接后分配到已断开的连接
+	poolServiceRefresh = 30 * time.Second
+)
+
+// RunPool 保持 Pool 条空闲的预建数据连接，每条被 srp-server 取用后立即建立新的连接补充
+func (c *Client) RunPool() {
+	for range c.Pool {
+		go c.runPoolSlot()
+	}
+}
+
+// runPoolSlot 建立一条预建数据连接并等待 srp-server 分配用户连接，分配后在新的 goroutine 中处理该用户连接
+func (c *Client) runPoolSlot() {
+	for {
+		link, _, err := c.dialServer(common.PingPayload{Session: c.Session, Pool: true})
+		if err != nil {
+			logger.Warn("无法建立预建数据连接", "err", err)
+			time.Sleep(poolRetryInterval)
+			continue
+		}
+		var svc *idleService
+		if c.PoolService {
+			svc = newIdleService(net.JoinHostPort(c.ServiceIP, strconv.Itoa(c.ServicePort)))
+		}
+
+		data := common.Proto{}
+		err = data.DecodeProtoLimit(link.Reader, common.MaxHandshakePayloadSize)
+		if err != nil || data.Type != common.TypeNewConn {
+			link.Conn.Close()
+			svc.close()
+			logger.Debug("预建数据连接断开", "err", err)
+			time.Sleep(poolRetryInterval)
+			continue
+		}
+		go c.servePooled(data.CID, link, svc.take())
+	}
+}
+
+// servePooled 处理 srp-server 经由预建数据连接 link 分配的用户连接，先回应 TypeAcceptConn 或 TypeRejectConn，
+// 之后与直连数据连接相同，conn 为预先建立的服务连接，为 nil 时建立新的服务连接
+func (c *Client) servePooled(cid uint32, link *Link, conn net.Conn) {
+	if conn == nil {
+		var err error
+		conn, err = net.Dial("tcp", net.JoinHostPort(c.ServiceIP, strconv.Itoa(c.ServicePort)))
+		if err != nil {
+			atomic.AddUint64(&c.DialFailures, 1)
+			logger.Warn("拒绝用户连接，无法和服务建立连接", "cid", cid, "err", err)
+			dataErr := common.NewProto(common.CodeForbidden, common.TypeRejectConn, cid, []byte(i18n.Sprintf("无法和服务建立连接：%s", err)))
+			link.Conn.Write(dataErr.AppendProto(nil))
+			link.Conn.Close()
+			return
+		}
+		(conn.(*net.TCPConn)).SetKeepAlive(true)
+	}
+	dataOk := common.NewProto(common.CodeSuccess, common.TypeAcceptConn, cid, []byte{})
+	if _, err := link.Conn.Write(dataOk.AppendProto(nil)); err != nil {
+		logger.Warn("无法向srp-server发送数据", "cid", cid, "err", err)
+		conn.Close()
+		link.Conn.Close()
+		return
+	}
+	logger.Debug("经由预建数据连接建立连接", "cid", cid, "local_addr", conn.LocalAddr().String(), "service_addr", conn.RemoteAddr().String())
+	c.spliceDirect(cid, link, conn)
+}
+
+// idleService 为预先建立的服务连接，空闲 poolServiceRefresh 后重新建立，被取用或关闭后不再建立
+type idleService struct {
+	addr string
+
+	mu    sync.Mutex
+	conn  net.Conn // 当前的服务连接，建立失败时为 nil
+	timer *time.Timer
+	done  bool
+}
+
+// newIdleService 在后台建立到 addr 的服务连接
+func newIdleService(addr string) *idleService {
+	s := &idleService{addr: addr}
+	go s.refresh()
+	return s
+}
+
+// refresh 建立新的服务连接替换之前的连接，并在 poolServiceRefresh 后再次替换
+func (s *idleService) refresh() {
+	conn, err := net.Dial("tcp", s.addr)
+	if err != nil {
+		logger.Debug("无法预先建立服务连接", "err", err)
+	} else {
+		(conn.(*net.TCPConn)).SetKeepAlive(true)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		if conn != nil {
+			conn.Close()
+		}
+		return
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	s.timer = time.AfterFunc(poolServiceRefresh, s.refresh)
+}
+
+// take 取出服务连接，s 为 nil 或服务连接尚未建立时返回 nil
+func (s *idleService) take() net.Conn {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	conn := s.conn
+	s.conn = nil
+	return conn
+}
+
+// close 关闭服务连接，s 为 nil 时不做任何事
+func (s *idleService) close() {
+	if conn := s.take(); conn != nil {
+		conn.Close()
+	}
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"srp/pkg/i18n"
+	"sync"
+)
+
+// 有效载荷的压缩算法，由隧道配置，握手时 srp-client 支持 CapCompression 才启用
+const (
+	CompressionNone    = "none"
+	CompressionDeflate = "deflate"
+)
+
+// minCompressSize 以内的有效载荷不压缩，压缩节省的字节数不足以抵消开销
+const minCompressSize = 256
+
+var (
+	// 压缩器的内部状态较大，复用以避免每帧分配，使用 BestSpeed 以减少转发的延迟
+	flateWriterPool = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	}}
+	flateReaderPool = sync.Pool{New: func() any {
+		return flate.NewReader(nil)
+	}}
+	errShortBuffer = errors.New("short buffer")
+)
+
+// fixedBuffer 为写满后返回错误的缓冲区，用于在压缩结果不小于原数据时尽早放弃
+type fixedBuffer struct {
+	b []byte
+	n int
+}
+
+func (f *fixedBuffer) Write(p []byte) (int, error) {
+	if f.n+len(p) > len(f.b) {
+		return 0, errShortBuffer
+	}
+	f.n += copy(f.b[f.n:], p)
+	return len(p), nil
+}
+
+// CompressProto 使用 deflate 压缩 TypeForwarding 帧的有效载荷，有效载荷较短或压缩后没有变小时返回 p 本身，
+// 否则返回设置了 Compressed 的新帧，其有效载荷来自缓冲池，使用后应调用 Release，p 不受影响
+func CompressProto(p Proto) Proto {
+	if p.Type != TypeForwarding || p.Compressed || len(p.Payload) < minCompressSize || len(p.Payload) > MaxBufferSize {
+		return p
+	}
+	buf := payloadPool.Get().(*[MaxBufferSize]byte)
+	// 压缩结果至少比原数据少一个字节才使用
+	out := &fixedBuffer{b: buf[:len(p.Payload)-1]}
+	w := flateWriterPool.Get().(*flate.Writer)
+	w.Reset(out)
+	_, err := w.Write(p.Payload)
+	if err == nil {
+		err = w.Close()
+	}
+	flateWriterPool.Put(w)
+	if err != nil {
+		payloadPool.Put(buf)
+		return p
+	}
+	c := NewProto(p.Code, p.Type, p.CID, buf[:out.n])
+	c.Compressed = true
+	c.buf = buf
+	return c
+}
+
+// DecompressProto 解压设置了 Compressed 的帧，解压后的有效载荷来自缓冲池，长度不能超过 MaxBufferSize，
+// 使用后应调用 Release，p 不受影响；p 未压缩时返回 p 本身
+func DecompressProto(p Proto) (Proto, error) {
+	if !p.Compressed {
+		return p, nil
+	}
+	buf := payloadPool.Get().(*[MaxBufferSize]byte)
+	r := flateReaderPool.Get().(io.ReadCloser)
+	r.(flate.Resetter).Reset(bytes.NewReader(p.Payload), nil)
+	var (
+		n   int
+		err error
+	)
+	for n < len(buf) && err == nil {
+		var m int
+		m, err = r.Read(buf[n:])
+		n += m
+	}
+	if err == nil {
+		// 缓冲区已满，确认数据已经结束，避免压缩炸弹
+		var one [1]byte
+		var m int
+		if m, err = r.Read(one[:]); m > 0 {
+			err = i18n.Errorf("解压后的有效载荷超过%d字节", MaxBufferSize)
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	flateReaderPool.Put(r)
+	if err != nil {
+		payloadPool.Put(buf)
+		return p, i18n.Errorf("无法解压有效载荷：%w", err)
+	}
+	d := NewProto(p.Code, p.Type, p.CID, buf[:n])
+	d.buf = buf
+	return d, nil
+}
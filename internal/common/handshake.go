@@ -0,0 +1,90 @@
+package common
+
+import (
+	"encoding/json"
+	"srp/pkg/ratelimit"
+)
+
+// PingPayload 为 TypePing 的有效载荷，srp-client 通过其完成验证并注册隧道
+type PingPayload struct {
+	Password string `json:"password"`
+	Tunnel   string `json:"tunnel"`            // 隧道名称
+	Name     string `json:"name"`              // srp-client 名称
+	Service  string `json:"service,omitempty"` // 被转发服务的地址，用于抓包等调试功能
+
+	// 支持的最高和最低协议版本以及支持的功能，旧版本 srp-client 不携带
+	Version      int        `json:"version,omitempty"`
+	MinVersion   int        `json:"min_version,omitempty"`
+	Capabilities Capability `json:"capabilities,omitempty"`
+	MaxPayload   uint32     `json:"max_payload,omitempty"` // 能够接收的有效载荷最大长度
+
+	// 支持 CapMultiConn 时的会话标识和希望使用的控制连接数，Link 为 0 时建立新的会话，
+	// 大于 0 时该连接作为第 Link 条控制连接加入 Session 标识的会话
+	Session string `json:"session,omitempty"`
+	Conns   int    `json:"conns,omitempty"`
+	Link    int    `json:"link,omitempty"`
+	// 支持 CapDirect 时不为 0 表示该连接为 Session 会话中 cid 为 DataCID 的用户连接的直连数据连接，
+	// 验证后双方在该连接上直接转发原始字节
+	DataCID uint32 `json:"data_cid,omitempty"`
+	// 支持 CapPool 时为 true 表示该连接为 Session 会话的预建数据连接，验证后在 srp-server 空闲等待，
+	// 分配用户连接时 srp-server 先发送携带 cid 的 TypeNewConn，srp-client 回应 TypeAcceptConn 或 TypeRejectConn，
+	// 之后与直连数据连接相同，双方直接转发原始字节
+	Pool bool `json:"pool,omitempty"`
+}
+
+// EncodePingPayload 转换 PingPayload 为字节数组
+func EncodePingPayload(p PingPayload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// PongPayload 为验证成功时 TypePong 的有效载荷，验证失败时有效载荷为失败原因
+type PongPayload struct {
+	Message   string          `json:"message"`
+	ConnLimit ratelimit.Limit `json:"conn_limit"` // 每个用户连接的下行限速，由 srp-client 执行
+
+	// 协商的协议版本和双方都支持的功能，旧版本 srp-server 不携带
+	Version      int        `json:"version,omitempty"`
+	Capabilities Capability `json:"capabilities,omitempty"`
+	MaxPayload   uint32     `json:"max_payload,omitempty"` // 能够接收的有效载荷最大长度
+
+	// 双方发送 TypeForwarding 时使用的压缩算法，由隧道配置，srp-client 不支持 CapCompression 时为空
+	Compression string `json:"compression,omitempty"`
+	// 会话使用的控制连接数，srp-client 需再建立 Conns-1 条连接加入会话，为 0 或 1 时只使用一条连接
+	Conns int `json:"conns,omitempty"`
+}
+
+// LinkIndex 返回承载 cid 的控制连接的序号，n 为会话的控制连接数，双方使用相同的规则，
+// 同一 cid 的帧总在同一条连接上传输，不会乱序；cid 为 0 的帧使用第一条连接
+func LinkIndex(cid uint32, n int) int {
+	if cid == 0 || n <= 1 {
+		return 0
+	}
+	return int(cid % uint32(n))
+}
+
+// EncodePongPayload 转换 PongPayload 为字节数组
+func EncodePongPayload(p PongPayload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// DecodePongPayload 转换字节数组为 PongPayload，有效载荷不是 JSON 时整体视为消息
+func DecodePongPayload(b []byte) PongPayload {
+	p := PongPayload{}
+	if err := json.Unmarshal(b, &p); err != nil {
+		p = PongPayload{Message: string(b)}
+	}
+	return p
+}
+
+// DecodePingPayload 转换字节数组为 PingPayload
+// 旧版本 srp-client 的有效载荷仅为密码，此时注册到默认隧道
+func DecodePingPayload(b []byte) PingPayload {
+	p := PingPayload{}
+	if err := json.Unmarshal(b, &p); err != nil {
+		p = PingPayload{Password: string(b)}
+	}
+	if p.Tunnel == "" {
+		p.Tunnel = DefaultTunnelName
+	}
+	return p
+}
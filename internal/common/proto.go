@@ -2,11 +2,14 @@ package common
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log/slog"
+	"srp/pkg/i18n"
+	"srp/pkg/utils"
 	"strings"
+	"sync"
 )
 
 type (
@@ -25,8 +28,31 @@ const (
 	TypeRejectConn TypeCode = 5 // 拒绝连接
 	TypeForwarding TypeCode = 6 // 数据转发
 	TypeDisconnect TypeCode = 7 // 断开连接
+	TypeHealth     TypeCode = 8 // 服务健康状态，CodeSuccess 为健康，CodeForbidden 为不健康
+
+	TypeHeartbeat    TypeCode = 9  // 心跳请求，有效载荷为发送时间
+	TypeHeartbeatAck TypeCode = 10 // 心跳响应，原样返回心跳请求的有效载荷
+
+	TypeKeyExchange TypeCode = 11 // 加密的密钥交换，在 TypePing 之前以明文发送，有效载荷为临时公钥
+
+	TypePause  TypeCode = 12 // 发往用户连接的数据积压，srp-client 暂停读取该连接的服务连接
+	TypeResume TypeCode = 13 // 积压的数据已写入用户连接，srp-client 恢复读取
 )
 
+// flagCompressed 为类型字节中表示有效载荷经过压缩的标志位，编解码时与 Proto.Compressed 相互转换
+const flagCompressed = 0x80
+
+// HeaderSize 为协议帧头的长度：状态码 1 字节、类型 1 字节、cid 4 字节和有效载荷长度 4 字节，均为大端序
+const HeaderSize = 10
+
+// smallPayloadSize 以内的有效载荷直接分配，不使用缓冲池，避免较短的帧占用整个缓冲区
+const smallPayloadSize = 1024
+
+// payloadPool 复用有效载荷的缓冲区，以数组指针存放，放回时不分配内存
+var payloadPool = sync.Pool{New: func() any {
+	return new([MaxBufferSize]byte)
+}}
+
 // Proto 为 srp-client 和 srp-server 之间的网络协议
 // 基于 TCP 协议设计，包含：状态、类型、连接序号、有效载荷长度和有效载荷字段
 type Proto struct {
@@ -35,74 +61,123 @@ type Proto struct {
 	CID        uint32 // Connection ID
 	PayloadLen uint32 // Payload 长度
 	Payload    []byte
+	Compressed bool // Payload 经过压缩，只在双方都支持 CapCompression 时使用
+
+	buf *[MaxBufferSize]byte // Payload 来自缓冲池时为其缓冲区，由 Release 归还
 }
 
 // EncodeProto 转换协议结构体为字节数组
 func (p *Proto) EncodeProto() ([]byte, error) {
-	buf := new(bytes.Buffer)
-
-	if err := binary.Write(buf, binary.BigEndian, p.Code); err != nil {
-		return nil, fmt.Errorf("编码Code失败: %w", err)
-	}
+	return p.AppendProto(make([]byte, 0, HeaderSize+len(p.Payload))), nil
+}
 
-	if err := binary.Write(buf, binary.BigEndian, p.Type); err != nil {
-		return nil, fmt.Errorf("编码Type失败: %w", err)
+// AppendProto 将编码后的协议帧追加到 b 并返回，PayloadLen 以 Payload 的实际长度为准
+func (p *Proto) AppendProto(b []byte) []byte {
+	t := byte(p.Type)
+	if p.Compressed {
+		t |= flagCompressed
 	}
+	b = append(b, byte(p.Code), t)
+	b = binary.BigEndian.AppendUint32(b, p.CID)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Payload)))
+	return append(b, p.Payload...)
+}
 
-	if err := binary.Write(buf, binary.BigEndian, p.CID); err != nil {
-		return nil, fmt.Errorf("编码cid失败: %w", err)
-	}
+// DecodeProto 转换字节数组为协议结构体，有效载荷的长度限制为 DefaultMaxPayloadSize
+func (p *Proto) DecodeProto(reader *bufio.Reader) error {
+	return p.DecodeProtoLimit(reader, DefaultMaxPayloadSize)
+}
 
-	if err := binary.Write(buf, binary.BigEndian, p.PayloadLen); err != nil {
-		return nil, fmt.Errorf("编码PayloadLen失败: %w", err)
+// DecodeProtoLimit 转换字节数组为协议结构体，状态码或类型未知、有效载荷长度超过 maxPayload 时返回错误，
+// 在分配有效载荷的内存前检查长度，避免对端声明的长度耗尽内存
+func (p *Proto) DecodeProtoLimit(reader *bufio.Reader, maxPayload uint32) error {
+	if err := p.decodeHeader(reader, maxPayload); err != nil {
+		return err
 	}
-
-	// []byte 不考虑大小端问题
+	p.buf = nil
+	p.Payload = nil
 	if p.PayloadLen > 0 {
-		if err := binary.Write(buf, binary.BigEndian, p.Payload); err != nil {
-			return nil, fmt.Errorf("编码Payload失败: %w", err)
-		}
+		p.Payload = make([]byte, p.PayloadLen)
 	}
-
-	return buf.Bytes(), nil
+	return p.readPayload(reader)
 }
 
-// DecodeProto 转换字节数组为协议结构体
-func (p *Proto) DecodeProto(reader *bufio.Reader) error {
-	// code 和 type 都是 uint8，直接读取 byte 即可
-	codeByte, err := reader.ReadByte()
-	if err != nil {
-		return fmt.Errorf("解码Code失败: %w", err)
+// ReadProto 同 DecodeProtoLimit，但较长的有效载荷使用缓冲池中的缓冲区，
+// 调用方使用完有效载荷后应调用 Release 归还，未归还的缓冲区由 GC 回收
+func (p *Proto) ReadProto(reader *bufio.Reader, maxPayload uint32) error {
+	if err := p.decodeHeader(reader, maxPayload); err != nil {
+		return err
 	}
-	p.Code = StatusCode(codeByte)
+	// 不归还上一帧的缓冲区，其所有权可能已经转移给其他 goroutine
+	p.buf = nil
+	p.Payload = nil
+	if p.PayloadLen > smallPayloadSize && p.PayloadLen <= MaxBufferSize {
+		p.buf = payloadPool.Get().(*[MaxBufferSize]byte)
+		p.Payload = p.buf[:p.PayloadLen]
+	} else if p.PayloadLen > 0 {
+		p.Payload = make([]byte, p.PayloadLen)
+	}
+	return p.readPayload(reader)
+}
 
-	typeByte, err := reader.ReadByte()
+// ReadPayload 从 r 读取一次数据作为有效载荷，有效载荷使用缓冲池中长度为 MaxBufferSize 的缓冲区，
+// 返回读取的字节数，读取失败时归还缓冲区，调用方使用完有效载荷后应调用 Release
+func (p *Proto) ReadPayload(r io.Reader) (int, error) {
+	p.buf = payloadPool.Get().(*[MaxBufferSize]byte)
+	n, err := r.Read(p.buf[:])
 	if err != nil {
-		return fmt.Errorf("解码Type失败: %w", err)
+		p.Release()
+		return 0, err
 	}
-	p.Type = TypeCode(typeByte)
+	p.Payload = p.buf[:n]
+	p.PayloadLen = uint32(n)
+	return n, nil
+}
 
-	cidBytes := make([]byte, 4)
-	if _, err := io.ReadFull(reader, cidBytes); err != nil {
-		return fmt.Errorf("解码cid失败: %w", err)
+// Release 将有效载荷的缓冲区归还缓冲池，有效载荷不是来自缓冲池时只清空有效载荷，
+// 调用后不能再使用原来的 Payload
+func (p *Proto) Release() {
+	if p.buf != nil {
+		payloadPool.Put(p.buf)
+		p.buf = nil
 	}
-	p.CID = binary.BigEndian.Uint32(cidBytes)
+	p.Payload = nil
+	p.PayloadLen = 0
+}
 
-	lenBytes := make([]byte, 4)
-	if _, err := io.ReadFull(reader, lenBytes); err != nil {
-		return fmt.Errorf("解码PayloadLen失败: %w", err)
+// decodeHeader 读取并检查帧头，直接使用 reader 的缓冲区，不分配内存
+func (p *Proto) decodeHeader(reader *bufio.Reader, maxPayload uint32) error {
+	header, err := reader.Peek(HeaderSize)
+	if err != nil {
+		if len(header) > 0 && err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return i18n.Errorf("解码帧头失败: %w", err)
 	}
-	p.PayloadLen = binary.BigEndian.Uint32(lenBytes)
+	p.Code = StatusCode(header[0])
+	p.Type = TypeCode(header[1] &^ flagCompressed)
+	p.Compressed = header[1]&flagCompressed != 0
+	p.CID = binary.BigEndian.Uint32(header[2:6])
+	p.PayloadLen = binary.BigEndian.Uint32(header[6:10])
+	reader.Discard(HeaderSize)
 
-	if p.PayloadLen > 0 {
-		p.Payload = make([]byte, p.PayloadLen)
-		if _, err := io.ReadFull(reader, p.Payload); err != nil {
-			return fmt.Errorf("解码Payload失败: %w", err)
-		}
-	} else {
-		p.Payload = nil
+	if _, ok := statusCodeMap[p.Code]; !ok {
+		return i18n.Errorf("未知的状态码%d", p.Code)
+	}
+	if _, ok := typeCodeMap[p.Type]; !ok {
+		return i18n.Errorf("未知的数据类型%d", p.Type)
 	}
+	if p.PayloadLen > maxPayload {
+		return i18n.Errorf("有效载荷长度%d超过上限%d", p.PayloadLen, maxPayload)
+	}
+	return nil
+}
 
+func (p *Proto) readPayload(reader *bufio.Reader) error {
+	if _, err := io.ReadFull(reader, p.Payload); err != nil {
+		p.Release()
+		return i18n.Errorf("解码Payload失败: %w", err)
+	}
 	return nil
 }
 
@@ -123,6 +198,47 @@ func (p *Proto) String() string {
 	)
 }
 
+// LogValue 实现 slog.LogValuer，在日志中以字段组输出协议帧
+func (p Proto) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("code", statusCodeToString(p.Code)),
+		slog.String("type", typeCodeToString(p.Type)),
+		slog.Any("cid", p.CID),
+		slog.Any("payload_len", p.PayloadLen),
+		slog.String("payload", bytesToHexString(p.Payload)),
+	)
+}
+
+// TypeName 返回数据类型的名称，如 TypeForwarding (6)
+func (p *Proto) TypeName() string {
+	return typeCodeToString(p.Type)
+}
+
+// CodeName 返回状态码的名称，如 CodeSuccess (1)
+func (p *Proto) CodeName() string {
+	return statusCodeToString(p.Code)
+}
+
+// CheckPayloadSize 检查有效载荷的长度是否超过对端能够接收的上限 maxPayload，maxPayload 为 0 时不检查
+func (p *Proto) CheckPayloadSize(maxPayload uint32) error {
+	if maxPayload > 0 && uint32(len(p.Payload)) > maxPayload {
+		return i18n.Errorf("有效载荷长度%d超过对端的上限%d", len(p.Payload), maxPayload)
+	}
+	return nil
+}
+
+// ParseMaxPayloadSize 解析有效载荷的最大长度，支持 K、M、G 单位，需在 MinMaxPayloadSize 到 1G 之间
+func ParseMaxPayloadSize(s string) (uint32, error) {
+	n, err := utils.ParseSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < MinMaxPayloadSize || n > 1<<30 {
+		return 0, i18n.Errorf("有效载荷最大长度需在%d到%d之间：%s", MinMaxPayloadSize, 1<<30, s)
+	}
+	return uint32(n), nil
+}
+
 // NewProto 返回新的协议结构体
 func NewProto(scode StatusCode, tcode TypeCode, cid uint32, payload []byte) Proto {
 	return Proto{
@@ -147,6 +263,15 @@ var typeCodeMap = map[TypeCode]string{
 	TypeRejectConn: "TypeRejectConn",
 	TypeForwarding: "TypeForwarding",
 	TypeDisconnect: "TypeDisconnect",
+	TypeHealth:     "TypeHealth",
+
+	TypeHeartbeat:    "TypeHeartbeat",
+	TypeHeartbeatAck: "TypeHeartbeatAck",
+
+	TypeKeyExchange: "TypeKeyExchange",
+
+	TypePause:  "TypePause",
+	TypeResume: "TypeResume",
 }
 
 // 辅助函数：将 StatusCode 转换为可读字符串
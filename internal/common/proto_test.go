@@ -0,0 +1,195 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// testPayload 返回长度为 n 的有效载荷，内容随下标变化以便发现错位
+func testPayload(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, smallPayloadSize, smallPayloadSize + 1, MaxBufferSize, MaxBufferSize + 1, DefaultMaxPayloadSize}
+	for _, n := range sizes {
+		for _, compressed := range []bool{false, true} {
+			p := NewProto(CodeSuccess, TypeForwarding, 42, testPayload(n))
+			p.Compressed = compressed
+			frame := p.AppendProto(nil)
+			if len(frame) != HeaderSize+n {
+				t.Fatalf("size %d: frame length %d, want %d", n, len(frame), HeaderSize+n)
+			}
+
+			var got Proto
+			if err := got.ReadProto(bufio.NewReader(bytes.NewReader(frame)), DefaultMaxPayloadSize); err != nil {
+				t.Fatalf("size %d: ReadProto: %v", n, err)
+			}
+			if got.Code != p.Code || got.Type != p.Type || got.CID != p.CID || got.Compressed != compressed ||
+				got.PayloadLen != uint32(n) || !bytes.Equal(got.Payload, p.Payload) {
+				t.Fatalf("size %d compressed %t: got %v", n, compressed, got.LogValue())
+			}
+			// 只有 smallPayloadSize 到 MaxBufferSize 之间的有效载荷使用缓冲池
+			pooled := n > smallPayloadSize && n <= MaxBufferSize
+			if (got.buf != nil) != pooled {
+				t.Fatalf("size %d: pooled %t, want %t", n, got.buf != nil, pooled)
+			}
+			got.Release()
+			if got.buf != nil || got.Payload != nil || got.PayloadLen != 0 {
+				t.Fatalf("size %d: Release left buf=%t payload=%d len=%d", n, got.buf != nil, len(got.Payload), got.PayloadLen)
+			}
+			got.Release() // 重复调用不能再次归还缓冲区
+		}
+	}
+}
+
+func TestDecodeProtoRoundTrip(t *testing.T) {
+	p := NewProto(CodeForbidden, TypeRejectConn, 7, []byte("rejected"))
+	var got Proto
+	if err := got.DecodeProto(bufio.NewReader(bytes.NewReader(p.AppendProto(nil)))); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != p.Code || got.Type != p.Type || got.CID != p.CID || string(got.Payload) != "rejected" || got.buf != nil {
+		t.Fatalf("got %v", got.LogValue())
+	}
+}
+
+func TestReadProtoOversize(t *testing.T) {
+	const limit = MaxBufferSize
+	p := NewProto(CodeSuccess, TypeForwarding, 1, testPayload(limit+1))
+	r := bufio.NewReader(bytes.NewReader(p.AppendProto(nil)))
+	var got Proto
+	if err := got.ReadProto(r, limit); err == nil {
+		t.Fatal("ReadProto accepted a payload over the limit")
+	}
+	if got.Payload != nil || got.buf != nil {
+		t.Fatal("ReadProto allocated a payload over the limit")
+	}
+	// 只读取了帧头，有效载荷留在 reader 中
+	if n, _ := io.Copy(io.Discard, r); n != limit+1 {
+		t.Fatalf("%d bytes left after the header, want %d", n, limit+1)
+	}
+}
+
+func TestReadProtoInvalid(t *testing.T) {
+	p := NewProto(CodeSuccess, TypeForwarding, 1, testPayload(smallPayloadSize+1))
+	valid := p.AppendProto(nil)
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"short header", valid[:HeaderSize-1]},
+		{"truncated payload", valid[:len(valid)-1]},
+		{"unknown code", append([]byte{0xff}, valid[1:]...)},
+		{"unknown type", append([]byte{valid[0], 0x7f}, valid[2:]...)},
+	}
+	for _, tt := range tests {
+		var got Proto
+		if err := got.ReadProto(bufio.NewReader(bytes.NewReader(tt.frame)), DefaultMaxPayloadSize); err == nil {
+			t.Fatalf("%s: ReadProto returned no error", tt.name)
+		}
+		// 读取失败时归还已取出的缓冲区
+		if got.buf != nil || got.Payload != nil {
+			t.Fatalf("%s: payload buffer not released", tt.name)
+		}
+	}
+}
+
+func TestReadPayload(t *testing.T) {
+	var p Proto
+	n, err := p.ReadPayload(bytes.NewReader([]byte("hello")))
+	if err != nil || n != 5 || string(p.Payload) != "hello" || p.PayloadLen != 5 || p.buf == nil {
+		t.Fatalf("ReadPayload = %d, %v, payload %q", n, err, p.Payload)
+	}
+	p.Release()
+	if _, err := p.ReadPayload(bytes.NewReader(nil)); err != io.EOF {
+		t.Fatalf("ReadPayload at EOF: %v", err)
+	}
+	if p.buf != nil || p.Payload != nil {
+		t.Fatal("ReadPayload kept the buffer after an error")
+	}
+}
+
+// encodeProtoBinaryWrite 为改用 AppendProto 之前的编码方式，作为基准测试的对照
+func encodeProtoBinaryWrite(p *Proto) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, p.Code)
+	binary.Write(buf, binary.BigEndian, p.Type)
+	binary.Write(buf, binary.BigEndian, p.CID)
+	binary.Write(buf, binary.BigEndian, p.PayloadLen)
+	if p.PayloadLen > 0 {
+		binary.Write(buf, binary.BigEndian, p.Payload)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeProtoMatchesBinaryWrite(t *testing.T) {
+	p := NewProto(CodeSuccess, TypeForwarding, 9, testPayload(smallPayloadSize))
+	if !bytes.Equal(p.AppendProto(nil), encodeProtoBinaryWrite(&p)) {
+		t.Fatal("AppendProto differs from the binary.Write encoding")
+	}
+}
+
+// BenchmarkEncodeProto 比较之前的 binary.Write 编码、每帧分配的 EncodeProto 和复用缓冲区的 AppendProto
+func BenchmarkEncodeProto(b *testing.B) {
+	p := NewProto(CodeSuccess, TypeForwarding, 1, testPayload(MaxBufferSize))
+	b.Run("binary.Write", func(b *testing.B) {
+		b.SetBytes(int64(HeaderSize + MaxBufferSize))
+		b.ReportAllocs()
+		for b.Loop() {
+			encodeProtoBinaryWrite(&p)
+		}
+	})
+	b.Run("EncodeProto", func(b *testing.B) {
+		b.SetBytes(int64(HeaderSize + MaxBufferSize))
+		b.ReportAllocs()
+		for b.Loop() {
+			p.EncodeProto()
+		}
+	})
+	b.Run("AppendProto", func(b *testing.B) {
+		buf := make([]byte, 0, HeaderSize+MaxBufferSize)
+		b.SetBytes(int64(HeaderSize + MaxBufferSize))
+		b.ReportAllocs()
+		for b.Loop() {
+			buf = p.AppendProto(buf[:0])
+		}
+	})
+}
+
+// BenchmarkReadProto 比较每帧分配有效载荷的 DecodeProtoLimit 和使用缓冲池的 ReadProto
+func BenchmarkReadProto(b *testing.B) {
+	p := NewProto(CodeSuccess, TypeForwarding, 1, testPayload(MaxBufferSize))
+	frame := p.AppendProto(nil)
+	decoders := []struct {
+		name   string
+		decode func(p *Proto, r *bufio.Reader) error
+	}{
+		{"DecodeProtoLimit", func(p *Proto, r *bufio.Reader) error { return p.DecodeProtoLimit(r, DefaultMaxPayloadSize) }},
+		{"ReadProto", func(p *Proto, r *bufio.Reader) error { return p.ReadProto(r, DefaultMaxPayloadSize) }},
+	}
+	for _, d := range decoders {
+		b.Run(d.name, func(b *testing.B) {
+			src := bytes.NewReader(frame)
+			r := bufio.NewReaderSize(src, 64*1024)
+			b.SetBytes(int64(len(frame)))
+			b.ReportAllocs()
+			for b.Loop() {
+				src.Reset(frame)
+				r.Reset(src)
+				var got Proto
+				if err := d.decode(&got, r); err != nil {
+					b.Fatal(err)
+				}
+				got.Release()
+			}
+		})
+	}
+}
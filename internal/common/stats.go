@@ -0,0 +1,58 @@
+package common
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// TrafficStats 为流量统计，字段均需使用原子操作访问
+// 上行为 user 到服务的方向，下行为服务到 user 的方向
+type TrafficStats struct {
+	BytesUp   uint64 // 上行有效载荷字节数
+	BytesDown uint64 // 下行有效载荷字节数
+	FramesIn  uint64 // 从对端接收的协议帧数
+	FramesOut uint64 // 向对端发送的协议帧数
+}
+
+func (t *TrafficStats) AddUp(n int) {
+	atomic.AddUint64(&t.BytesUp, uint64(n))
+}
+
+func (t *TrafficStats) AddDown(n int) {
+	atomic.AddUint64(&t.BytesDown, uint64(n))
+}
+
+func (t *TrafficStats) AddFrameIn() {
+	atomic.AddUint64(&t.FramesIn, 1)
+}
+
+func (t *TrafficStats) AddFrameOut() {
+	atomic.AddUint64(&t.FramesOut, 1)
+}
+
+// Snapshot 返回统计数据的副本
+func (t *TrafficStats) Snapshot() TrafficStats {
+	return TrafficStats{
+		BytesUp:   atomic.LoadUint64(&t.BytesUp),
+		BytesDown: atomic.LoadUint64(&t.BytesDown),
+		FramesIn:  atomic.LoadUint64(&t.FramesIn),
+		FramesOut: atomic.LoadUint64(&t.FramesOut),
+	}
+}
+
+// NewHeartbeat 返回携带当前时间的心跳请求，对端以 TypeHeartbeatAck 原样返回有效载荷
+func NewHeartbeat() Proto {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+	return NewProto(CodeSuccess, TypeHeartbeat, 0, payload)
+}
+
+// HeartbeatRTT 根据心跳响应计算控制连接的往返时延
+func HeartbeatRTT(ack Proto) (time.Duration, bool) {
+	if len(ack.Payload) != 8 {
+		return 0, false
+	}
+	sent := int64(binary.BigEndian.Uint64(ack.Payload))
+	return time.Since(time.Unix(0, sent)), true
+}
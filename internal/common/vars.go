@@ -4,8 +4,25 @@ import "time"
 
 const (
 	DefaultServerPasswd = "default_password"
+	DefaultTunnelName   = "default"
 	MaxBufferSize       = 65507
 	UDPTimeOut          = 3 * time.Minute
+	HeartbeatInterval   = 10 * time.Second
+
+	// DefaultMaxPayloadSize 为默认能够接收的协议帧有效载荷的最大长度
+	DefaultMaxPayloadSize = 1 << 20
+	// MinMaxPayloadSize 为有效载荷最大长度的下限，需能容纳一次读取的用户数据
+	MinMaxPayloadSize = MaxBufferSize
+	// MaxHandshakePayloadSize 为握手时 TypePing 和 TypePong 有效载荷的最大长度，验证前不接受更大的帧
+	MaxHandshakePayloadSize = 4096
+	// DefaultReadTimeout 为默认的控制连接读取超时时间，双方都支持心跳时，超过该时间未收到任何帧则断开连接
+	DefaultReadTimeout = 3 * HeartbeatInterval
+	// MaxControlConns 为一个 srp-client 会话的控制连接数上限
+	MaxControlConns = 16
+	// MaxPoolSize 为一个 srp-client 会话的空闲预建数据连接数上限
+	MaxPoolSize = 64
+	// NewConnTimeout 为 srp-server 等待 srp-client 响应连接申请的最长时间，也是 srp-client 连接服务的超时时间
+	NewConnTimeout = 10 * time.Second
 )
 
 var (
@@ -16,4 +33,17 @@ var (
 		"tcp",
 		"udp",
 	}
+
+	// Compressions 支持的有效载荷压缩算法
+	Compressions = []string{
+		CompressionNone,
+		CompressionDeflate,
+	}
+
+	// Balancers 支持的负载均衡策略
+	Balancers = []string{
+		"round-robin",
+		"least-conn",
+		"ip-hash",
+	}
 )
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"srp/pkg/i18n"
+	"strings"
+)
+
+// 协议版本，协议帧的格式或已有类型的含义发生不兼容的变化时增加 ProtocolVersion，
+// 新增可选功能时只需增加 Capability，不需要增加版本
+const (
+	// LegacyProtocolVersion 为不携带版本的旧版本 srp-client 和 srp-server 的协议版本
+	LegacyProtocolVersion = 1
+	// ProtocolVersion 为当前的协议版本
+	ProtocolVersion = 2
+	// MinProtocolVersion 为能够互通的最低协议版本
+	MinProtocolVersion = LegacyProtocolVersion
+)
+
+// Capability 为以位图表示的可选功能，握手时双方交换各自支持的功能，只启用双方都支持的功能
+type Capability uint32
+
+const (
+	CapHeartbeat   Capability = 1 << iota // 控制连接的心跳，TypeHeartbeat 和 TypeHeartbeatAck
+	CapHealth                             // 服务健康状态，TypeHealth
+	CapCompression                        // TypeForwarding 有效载荷的压缩，是否使用由隧道配置
+	CapMultiConn                          // 一个会话使用多条控制连接，用户连接按 cid 分散到各条连接
+	CapDirect                             // TCP 用户连接使用单独的直连数据连接，不经由控制连接转发
+	CapPool                               // srp-client 预先建立空闲的数据连接，TCP 用户连接直接交给其中一条
+	CapFlowControl                        // 按用户连接的流量控制，TypePause 和 TypeResume
+)
+
+// Capabilities 为当前版本支持的所有功能
+const Capabilities = CapHeartbeat | CapHealth | CapCompression | CapMultiConn | CapDirect | CapPool | CapFlowControl
+
+var capabilityNames = []struct {
+	c    Capability
+	name string
+}{
+	{CapHeartbeat, "heartbeat"},
+	{CapHealth, "health"},
+	{CapCompression, "compression"},
+	{CapMultiConn, "multiconn"},
+	{CapDirect, "direct"},
+	{CapPool, "pool"},
+	{CapFlowControl, "flowcontrol"},
+}
+
+// Has 返回是否包含功能 f
+func (c Capability) Has(f Capability) bool {
+	return c&f == f
+}
+
+// String 返回以逗号分隔的功能名称，未知的功能以其位图值表示
+func (c Capability) String() string {
+	var names []string
+	for _, n := range capabilityNames {
+		if c.Has(n.c) {
+			names = append(names, n.name)
+			c &^= n.c
+		}
+	}
+	if c != 0 {
+		names = append(names, i18n.Sprintf("未知功能0x%x", uint32(c)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// NegotiateVersion 返回双方都支持的最高协议版本，peer 和 peerMin 为对端支持的最高和最低版本，
+// 为 0 时表示不携带版本的旧版本，双方支持的版本没有交集时返回错误
+func NegotiateVersion(peer, peerMin int) (int, error) {
+	if peer == 0 {
+		peer = LegacyProtocolVersion
+	}
+	if peerMin == 0 {
+		peerMin = LegacyProtocolVersion
+	}
+	v := min(peer, ProtocolVersion)
+	if v < MinProtocolVersion || v < peerMin {
+		return 0, i18n.Errorf("不兼容的协议版本，对端支持%d-%d，本端支持%d-%d", peerMin, peer, MinProtocolVersion, ProtocolVersion)
+	}
+	return v, nil
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxPendingSize 为 FrameWriter 中等待写入的字节数上限，超过后 Send 阻塞直到写入完成，
+// 避免连接较慢时队列无限增长
+const maxPendingSize = 1 << 20
+
+// closeFlushTimeout 为 Close 写入剩余帧的最长时间，对端停止读取时 Close 不会一直阻塞
+const closeFlushTimeout = 5 * time.Second
+
+// FrameWriter 串行写入控制连接，所有协议帧由一个 goroutine 写入，多个 goroutine 同时发送时帧不会交错。
+// 写入期间到达的帧合并到下一次写入，FlushDelay 大于 0 时收到第一帧后再等待该时间以合并更多的帧，
+// 以少量的延迟换取更少的系统调用
+type FrameWriter struct {
+	FlushDelay time.Duration
+
+	w io.Writer
+
+	mu      sync.Mutex
+	space   *sync.Cond // 等待写入的字节数低于上限或写入失败时通知
+	pending []byte     // 等待写入的帧
+	spare   []byte     // 上一次写入使用的缓冲区，与 pending 交替使用
+	err     error      // 写入失败后的错误，之后的 Send 均返回该错误
+	closed  bool
+
+	notify chan struct{}
+	done   chan struct{}
+}
+
+// NewFrameWriter 返回写入 w 的 FrameWriter 并启动写入的 goroutine，使用完后需调用 Close
+func NewFrameWriter(w io.Writer, flushDelay time.Duration) *FrameWriter {
+	fw := &FrameWriter{
+		FlushDelay: flushDelay,
+		w:          w,
+		notify:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	fw.space = sync.NewCond(&fw.mu)
+	go fw.run()
+	return fw
+}
+
+// Send 编码协议帧并放入写入队列，返回后 p 的有效载荷可以被复用或归还缓冲池，
+// 之前的写入失败或已关闭时返回错误
+func (fw *FrameWriter) Send(p Proto) error {
+	fw.mu.Lock()
+	for fw.err == nil && !fw.closed && len(fw.pending) >= maxPendingSize {
+		fw.space.Wait()
+	}
+	if fw.err != nil {
+		fw.mu.Unlock()
+		return fw.err
+	}
+	if fw.closed {
+		fw.mu.Unlock()
+		return net.ErrClosed
+	}
+	wasEmpty := len(fw.pending) == 0
+	fw.pending = p.AppendProto(fw.pending)
+	fw.mu.Unlock()
+
+	if wasEmpty {
+		fw.wake()
+	}
+	return nil
+}
+
+// Close 写入队列中剩余的帧后停止写入的 goroutine，不关闭底层连接。
+// 底层连接支持写入期限时最多等待 closeFlushTimeout，之后丢弃剩余的帧并恢复为不设期限
+func (fw *FrameWriter) Close() error {
+	if d, ok := fw.w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		d.SetWriteDeadline(time.Now().Add(closeFlushTimeout))
+		defer d.SetWriteDeadline(time.Time{})
+	}
+	fw.mu.Lock()
+	fw.closed = true
+	fw.space.Broadcast()
+	fw.mu.Unlock()
+	fw.wake()
+	<-fw.done
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.err
+}
+
+func (fw *FrameWriter) wake() {
+	select {
+	case fw.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (fw *FrameWriter) run() {
+	defer close(fw.done)
+	for range fw.notify {
+		if fw.FlushDelay > 0 {
+			time.Sleep(fw.FlushDelay)
+		}
+		fw.mu.Lock()
+		buf := fw.pending
+		fw.pending = fw.spare[:0]
+		closed := fw.closed
+		fw.mu.Unlock()
+
+		if len(buf) > 0 {
+			if _, err := fw.w.Write(buf); err != nil {
+				fw.mu.Lock()
+				fw.err = err
+				fw.pending = nil
+				fw.space.Broadcast()
+				fw.mu.Unlock()
+				return
+			}
+		}
+
+		fw.mu.Lock()
+		// 突发流量使缓冲区变得很大时不再复用
+		if cap(buf) <= 2*maxPendingSize {
+			fw.spare = buf[:0]
+		} else {
+			fw.spare = nil
+		}
+		fw.space.Broadcast()
+		// 写入期间有新的帧到达时其发送者看到的队列非空，不会唤醒，需要继续写入
+		if len(fw.pending) > 0 {
+			fw.wake()
+		} else if closed || fw.closed {
+			fw.mu.Unlock()
+			return
+		}
+		fw.mu.Unlock()
+	}
+}
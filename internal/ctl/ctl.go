@@ -0,0 +1,162 @@
+// Package ctl 为 srp-server 管理接口的客户端
+package ctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"srp/internal/server"
+	"srp/pkg/i18n"
+	"strconv"
+	"strings"
+)
+
+// Client 通过 Unix 域套接字或 TCP 访问 srp-server 的管理接口
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// New 返回管理接口的客户端，addr 的格式同 srp-server 的 admin-addr 参数，
+// 即 unix:/run/srp.sock 或 127.0.0.1:9200，也可以是 http:// 或 https:// 开头的地址
+func New(addr, token string) *Client {
+	c := &Client{BaseURL: addr, Token: token, HTTPClient: &http.Client{}}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		c.BaseURL = "http://srp-server"
+		c.HTTPClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	} else if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		c.BaseURL = "http://" + addr
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+	return c
+}
+
+// request 发送请求，状态码不为 200 时返回管理接口给出的错误
+func (c *Client) request(method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var e struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("%s", e.Error)
+		}
+		return nil, i18n.Errorf("管理接口返回%s", resp.Status)
+	}
+	return resp, nil
+}
+
+// do 发送请求并将响应解码到 out 中
+func (c *Client) do(method, path string, out any) error {
+	resp, err := c.request(method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Clients 返回已连接的 srp-client
+func (c *Client) Clients() ([]server.ClientView, error) {
+	var views []server.ClientView
+	return views, c.do(http.MethodGet, "/api/clients", &views)
+}
+
+// Tunnels 返回所有隧道
+func (c *Client) Tunnels() ([]server.TunnelView, error) {
+	var views []server.TunnelView
+	return views, c.do(http.MethodGet, "/api/tunnels", &views)
+}
+
+// Tunnel 返回隧道的状态和统计
+func (c *Client) Tunnel(name string) (server.TunnelView, error) {
+	var view server.TunnelView
+	return view, c.do(http.MethodGet, "/api/tunnels/"+url.PathEscape(name), &view)
+}
+
+// Conns 返回用户连接，tunnel 不为空时只返回该隧道的连接
+func (c *Client) Conns(tunnel string) ([]server.ConnView, error) {
+	path := "/api/conns"
+	if tunnel != "" {
+		path += "?tunnel=" + url.QueryEscape(tunnel)
+	}
+	var views []server.ConnView
+	return views, c.do(http.MethodGet, path, &views)
+}
+
+// Events 返回最近的 n 个事件
+func (c *Client) Events(n int) ([]server.Event, error) {
+	var events []server.Event
+	return events, c.do(http.MethodGet, "/api/events?n="+strconv.Itoa(n), &events)
+}
+
+// FollowEvents 先返回最近的 n 个事件，再持续返回新事件，直到连接断开或 fn 返回错误
+func (c *Client) FollowEvents(n int, fn func(server.Event) error) error {
+	resp, err := c.request(http.MethodGet, "/api/events?follow=1&n="+strconv.Itoa(n))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var e server.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// KickConn 断开用户连接
+func (c *Client) KickConn(cid uint32) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/api/conns/%d", cid), &struct{}{})
+}
+
+// DisconnectClient 断开 srp-client
+func (c *Client) DisconnectClient(id uint32) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/api/clients/%d", id), &struct{}{})
+}
+
+// SetTunnelEnabled 启用或停用隧道
+func (c *Client) SetTunnelEnabled(name string, enabled bool) error {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+	return c.do(http.MethodPost, "/api/tunnels/"+url.PathEscape(name)+"/"+action, &struct{}{})
+}
+
+// Reload 让 srp-server 重新加载隧道配置文件
+func (c *Client) Reload() (server.ReloadResult, error) {
+	var result server.ReloadResult
+	return result, c.do(http.MethodPost, "/api/reload", &result)
+}
@@ -0,0 +1,170 @@
+// Package record 录制和读取 srp-client 与 srp-server 之间的协议帧，用于离线重放和排查问题
+//
+// 录制文件以 Magic 开头，之后依次为每一帧的方向（1 字节）、时间（Unix 纳秒，8 字节大端序）
+// 和按 common.Proto.EncodeProto 编码的协议帧
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"srp/internal/common"
+	"srp/pkg/i18n"
+	"sync"
+	"time"
+)
+
+// Magic 为录制文件的文件头
+const Magic = "SRPREC1\n"
+
+// Direction 为协议帧的方向
+type Direction byte
+
+const (
+	ClientToServer Direction = 1 // srp-client 发往 srp-server
+	ServerToClient Direction = 2 // srp-server 发往 srp-client
+)
+
+func (d Direction) String() string {
+	switch d {
+	case ClientToServer:
+		return "C->S"
+	case ServerToClient:
+		return "S->C"
+	}
+	return "?"
+}
+
+// Reverse 返回相反的方向
+func (d Direction) Reverse() Direction {
+	if d == ClientToServer {
+		return ServerToClient
+	}
+	return ClientToServer
+}
+
+// Frame 为录制的一帧
+type Frame struct {
+	Time  time.Time
+	Dir   Direction
+	Proto common.Proto
+}
+
+// Writer 将协议帧写入录制文件，可以并发调用
+type Writer struct {
+	mu sync.Mutex
+	f  *os.File
+	bw *bufio.Writer
+}
+
+// Create 创建录制文件并写入文件头
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{f: f, bw: bufio.NewWriter(f)}
+	if _, err := w.bw.WriteString(Magic); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write 写入一帧，w 为 nil 时不做任何操作
+func (w *Writer) Write(dir Direction, p common.Proto) error {
+	if w == nil {
+		return nil
+	}
+	b := make([]byte, 9, 9+common.HeaderSize+len(p.Payload))
+	b[0] = byte(dir)
+	binary.BigEndian.PutUint64(b[1:], uint64(time.Now().UnixNano()))
+	b = p.AppendProto(b)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return os.ErrClosed
+	}
+	w.bw.Write(b)
+	// 每帧写入文件，进程异常退出时也能保留已录制的帧
+	return w.bw.Flush()
+}
+
+// Close 关闭录制文件，w 为 nil 时不做任何操作
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.bw.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+	return err
+}
+
+// Reader 读取录制文件
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader 读取并检查文件头
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != Magic {
+		return nil, i18n.Errorf("不是srp录制文件")
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next 返回下一帧，没有更多帧时返回 io.EOF
+func (r *Reader) Next() (Frame, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Frame{}, i18n.Errorf("录制文件不完整")
+		}
+		return Frame{}, err
+	}
+	f := Frame{
+		Dir:  Direction(header[0]),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(header[1:]))),
+	}
+	if err := f.Proto.DecodeProto(r.r); err != nil {
+		return Frame{}, i18n.Errorf("录制文件不完整：%w", err)
+	}
+	return f, nil
+}
+
+// ReadFile 读取录制文件中的所有帧
+func ReadFile(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var frames []Frame
+	for {
+		frame, err := r.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"srp/pkg/i18n"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormats 支持的访问日志格式
+var AccessLogFormats = []string{"json", "clf"}
+
+// clfTimeFormat 为 Common Log Format 的时间格式
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessRecord 为一个结束的用户连接的访问记录
+type AccessRecord struct {
+	Time       time.Time `json:"time"` // 连接结束的时间
+	Tunnel     string    `json:"tunnel"`
+	ClientID   uint32    `json:"client_id"`
+	Client     string    `json:"client"`      // 承载该连接的 srp-client 名称
+	ClientAddr string    `json:"client_addr"` // 承载该连接的 srp-client 地址
+	UserAddr   string    `json:"user_addr"`
+	CID        uint32    `json:"cid"`
+	Protocol   string    `json:"protocol"`
+	Duration   float64   `json:"duration"` // 单位秒
+	BytesUp    uint64    `json:"bytes_up"`
+	BytesDown  uint64    `json:"bytes_down"`
+	Reason     string    `json:"reason"` // 连接关闭的原因
+}
+
+// AccessLog 为用户连接的访问日志，每个结束的用户连接写入一条记录
+type AccessLog struct {
+	Format string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAccessLog 返回以 format 格式写入 w 的访问日志
+func NewAccessLog(w io.Writer, format string) (*AccessLog, error) {
+	switch format {
+	case "json", "clf":
+	default:
+		return nil, i18n.Errorf("未知的访问日志格式：%s，支持：%s", format, i18n.Join(AccessLogFormats))
+	}
+	return &AccessLog{Format: format, w: w}, nil
+}
+
+// Write 写入一条记录
+func (l *AccessLog) Write(r AccessRecord) error {
+	var line []byte
+	if l.Format == "json" {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		line = append(b, '\n')
+	} else {
+		line = []byte(formatCLF(r))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(line)
+	return err
+}
+
+// formatCLF 以 Common Log Format 格式化记录，用户地址、srp-client 名称和时间对应 host、authuser 和 date，
+// 请求行为 "协议 隧道 cid"，status 为 -，bytes 为发往用户的字节数，其后依次为上行字节数、时长和关闭原因
+func formatCLF(r AccessRecord) string {
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %d\" - %d %d %.3f %s\n",
+		r.UserAddr, clfField(r.Client), r.Time.Format(clfTimeFormat),
+		strings.ToUpper(r.Protocol), r.Tunnel, r.CID,
+		r.BytesDown, r.BytesUp, r.Duration, strconv.Quote(r.Reason))
+}
+
+// clfField 空值以 - 表示，空白替换为 _ 以免破坏字段的分隔
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Join(strings.Fields(s), "_")
+}
+
+// LogAccess 将结束的用户连接写入访问日志，未启用访问日志时不记录
+func (s *Server) LogAccess(info *UserConnInfo) {
+	if s.AccessLog == nil {
+		return
+	}
+	now := time.Now()
+	st := info.Stats.Snapshot()
+	err := s.AccessLog.Write(AccessRecord{
+		Time:       now,
+		Tunnel:     info.Tunnel.Name,
+		ClientID:   info.Client.ID,
+		Client:     info.Client.Name,
+		ClientAddr: info.Client.Conn.RemoteAddr().String(),
+		UserAddr:   info.UserAddr.String(),
+		CID:        info.CID,
+		Protocol:   info.Tunnel.ServiceProtocol,
+		Duration:   now.Sub(info.CreatedAt).Seconds(),
+		BytesUp:    st.BytesUp,
+		BytesDown:  st.BytesDown,
+		Reason:     info.CloseReason(),
+	})
+	if err != nil {
+		info.Client.Log.Warn("无法写入访问日志", "cid", info.CID, "err", err)
+	}
+}
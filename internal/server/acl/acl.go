@@ -0,0 +1,84 @@
+package acl
+
+import (
+	"net"
+	"net/netip"
+	"srp/pkg/i18n"
+	"srp/pkg/utils"
+	"strings"
+)
+
+// ACL 为用户连接的访问控制规则，支持 IPv4 和 IPv6 的 CIDR 或单个 IP
+// 先匹配 Deny，命中则拒绝；Allow 不为空时，未命中 Allow 的地址也被拒绝
+type ACL struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// New 解析允许和拒绝的规则列表
+func New(allow, deny []string) (*ACL, error) {
+	a := &ACL{}
+	var err error
+	if a.Allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if a.Deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parsePrefixes(rules []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, r := range rules {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if !strings.Contains(r, "/") {
+			addr, err := netip.ParseAddr(r)
+			if err != nil {
+				return nil, i18n.Errorf("无效的IP地址：%s", r)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(r)
+		if err != nil {
+			return nil, i18n.Errorf("无效的CIDR：%s", r)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// Empty 返回是否没有任何规则
+func (a *ACL) Empty() bool {
+	return a == nil || (len(a.Allow) == 0 && len(a.Deny) == 0)
+}
+
+// Permit 返回是否允许该地址的连接
+func (a *ACL) Permit(addr net.Addr) bool {
+	if a.Empty() {
+		return true
+	}
+	ip, ok := utils.AddrIP(addr)
+	if !ok {
+		return false
+	}
+	for _, p := range a.Deny {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	if len(a.Allow) == 0 {
+		return true
+	}
+	for _, p := range a.Allow {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
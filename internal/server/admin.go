@@ -0,0 +1,173 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"srp/pkg/i18n"
+	"srp/pkg/logger"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler 返回管理接口的 http.Handler，token 不为空时请求需携带 Authorization: Bearer <token>
+//
+//	GET    /api/clients                 列出已连接的 srp-client
+//	DELETE /api/clients/{id}            断开 srp-client
+//	GET    /api/tunnels                 列出隧道
+//	GET    /api/tunnels/{name}          隧道的状态和统计
+//	POST   /api/tunnels/{name}/enable   启用隧道
+//	POST   /api/tunnels/{name}/disable  停用隧道，拒绝新的用户连接
+//	GET    /api/conns[?tunnel=name]     列出用户连接
+//	DELETE /api/conns/{cid}             断开用户连接
+//	GET    /api/events[?n=100]          最近的事件
+//	GET    /api/events?follow=1         以每行一个 JSON 的格式持续推送最近和新的事件
+//	POST   /api/reload                  重新加载隧道配置文件
+func (s *Server) AdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.ListClients())
+	})
+	mux.HandleFunc("DELETE /api/clients/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("无效的srp-client id：%s", r.PathValue("id")))
+			return
+		}
+		s.adminResult(w, r, s.DisconnectClient(uint32(id)))
+	})
+	mux.HandleFunc("GET /api/tunnels", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.ListTunnels())
+	})
+	mux.HandleFunc("GET /api/tunnels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		view, err := s.GetTunnelView(r.PathValue("name"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+	})
+	mux.HandleFunc("POST /api/tunnels/{name}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("action") {
+		case "enable":
+			s.adminResult(w, r, s.SetTunnelEnabled(r.PathValue("name"), true))
+		case "disable":
+			s.adminResult(w, r, s.SetTunnelEnabled(r.PathValue("name"), false))
+		default:
+			writeError(w, http.StatusNotFound, i18n.Errorf("未知的操作：%s", r.PathValue("action")))
+		}
+	})
+	mux.HandleFunc("GET /api/conns", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.ListUserConns(r.URL.Query().Get("tunnel")))
+	})
+	mux.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		if r.URL.Query().Get("follow") == "" {
+			writeJSON(w, http.StatusOK, s.Events.Recent(n))
+			return
+		}
+		s.followEvents(w, r, n)
+	})
+	mux.HandleFunc("POST /api/reload", func(w http.ResponseWriter, r *http.Request) {
+		logger.Info("管理接口", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		s.AddEvent(EventAdmin, "", "", 0, r.Method+" "+r.URL.Path)
+		result, err := s.ReloadTunnels()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("DELETE /api/conns/{cid}", func(w http.ResponseWriter, r *http.Request) {
+		cid, err := strconv.ParseUint(r.PathValue("cid"), 10, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, i18n.Errorf("无效的cid：%s", r.PathValue("cid")))
+			return
+		}
+		s.adminResult(w, r, s.KickUserConn(uint32(cid)))
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+				writeError(w, http.StatusUnauthorized, i18n.Errorf("未授权"))
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// adminResult 记录管理操作并返回结果
+func (s *Server) adminResult(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	logger.Info("管理接口", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+	s.AddEvent(EventAdmin, "", "", 0, r.Method+" "+r.URL.Path)
+	writeJSON(w, http.StatusOK, map[string]string{"result": "ok"})
+}
+
+// followEvents 先推送最近的 n 个事件，再持续推送新事件，直到请求结束
+func (s *Server) followEvents(w http.ResponseWriter, r *http.Request, n int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, i18n.Errorf("不支持推送事件"))
+		return
+	}
+	// 先订阅再读取最近的事件，避免遗漏两者之间的事件
+	events, cancel := s.Events.Subscribe()
+	defer cancel()
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for _, e := range s.Events.Recent(n) {
+		enc.Encode(e)
+	}
+	flusher.Flush()
+	for {
+		select {
+		case e := <-events:
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// ListenAdmin 监听管理接口的地址，以 unix: 开头时监听 Unix 域套接字
+func ListenAdmin(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	// 删除上次运行遗留的套接字文件
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// 只允许当前用户访问
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
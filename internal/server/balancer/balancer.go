@@ -0,0 +1,133 @@
+package balancer
+
+import (
+	"hash/crc32"
+	"net"
+	"sort"
+	"srp/pkg/i18n"
+	"srp/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Node 为可被负载均衡选择的节点，即注册到同一隧道的 srp-client
+type Node interface {
+	Key() string   // 节点的唯一标识，用于一致性哈希
+	Active() int64 // 节点当前承载的用户连接数
+}
+
+// Balancer 从多个节点中为新的用户连接选择一个节点
+type Balancer interface {
+	Pick(nodes []Node, userAddr net.Addr) Node
+}
+
+// New 根据策略名称返回对应的 Balancer
+func New(strategy string) (Balancer, error) {
+	switch strategy {
+	case "", "round-robin":
+		return &RoundRobin{}, nil
+	case "least-conn":
+		return &LeastConn{}, nil
+	case "ip-hash":
+		return &IPHash{}, nil
+	default:
+		return nil, i18n.Errorf("不支持的负载均衡策略：%s", strategy)
+	}
+}
+
+// RoundRobin 依次轮流选择节点
+type RoundRobin struct {
+	counter uint64
+}
+
+func (r *RoundRobin) Pick(nodes []Node, _ net.Addr) Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&r.counter, 1)
+	return nodes[(n-1)%uint64(len(nodes))]
+}
+
+// LeastConn 选择当前用户连接数最少的节点，连接数相同时轮流选择
+type LeastConn struct {
+	rr RoundRobin
+}
+
+func (l *LeastConn) Pick(nodes []Node, userAddr net.Addr) Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	var least []Node
+	fewest := int64(-1)
+	for _, n := range nodes {
+		a := n.Active()
+		switch {
+		case fewest < 0 || a < fewest:
+			fewest = a
+			least = append(least[:0], n)
+		case a == fewest:
+			least = append(least, n)
+		}
+	}
+	return l.rr.Pick(least, userAddr)
+}
+
+// 每个节点在哈希环上的虚拟节点数
+const virtualNodes = 100
+
+// IPHash 根据用户 IP 在一致性哈希环上选择节点，
+// 同一用户 IP 的连接在节点不变时总是被分配到同一节点，
+// 节点增减时只有少部分用户 IP 会被重新分配
+type IPHash struct {
+	mu    sync.Mutex
+	sig   string   // 构建哈希环时的节点集合
+	ring  []uint32 // 有序的虚拟节点哈希值
+	owner map[uint32]string
+}
+
+func (h *IPHash) Pick(nodes []Node, userAddr net.Addr) Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	byKey := make(map[string]Node, len(nodes))
+	keys := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		byKey[n.Key()] = n
+		keys = append(keys, n.Key())
+	}
+	sort.Strings(keys)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if sig := strings.Join(keys, "\x00"); sig != h.sig {
+		h.build(keys)
+		h.sig = sig
+	}
+
+	ip, _ := utils.AddrIP(userAddr)
+	sum := crc32.ChecksumIEEE([]byte(ip.String()))
+	i := sort.Search(len(h.ring), func(i int) bool { return h.ring[i] >= sum })
+	if i == len(h.ring) {
+		i = 0
+	}
+	return byKey[h.owner[h.ring[i]]]
+}
+
+// build 重新构建哈希环
+func (h *IPHash) build(keys []string) {
+	h.ring = make([]uint32, 0, len(keys)*virtualNodes)
+	h.owner = make(map[uint32]string, len(keys)*virtualNodes)
+	for _, k := range keys {
+		for i := 0; i < virtualNodes; i++ {
+			sum := crc32.ChecksumIEEE([]byte(k + "#" + strconv.Itoa(i)))
+			if _, ok := h.owner[sum]; ok {
+				continue
+			}
+			h.owner[sum] = k
+			h.ring = append(h.ring, sum)
+		}
+	}
+	sort.Slice(h.ring, func(i, j int) bool { return h.ring[i] < h.ring[j] })
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"srp/pkg/pcapng"
+	"time"
+)
+
+// startCapture 在 CaptureDir 中为用户连接创建 pcapng 抓包文件，未启用抓包或创建失败时返回 nil，
+// 数据包的两端为用户地址和 srp-client 报告的服务地址，无法得到服务地址时使用隧道的监听地址
+func (s *Server) startCapture(info *UserConnInfo, local net.Addr) *pcapng.Flow {
+	if s.CaptureDir == "" {
+		return nil
+	}
+	log := info.Client.Log.With("cid", info.CID)
+	user, err := netip.ParseAddrPort(info.UserAddr.String())
+	if err != nil {
+		log.Warn("无法抓包，无效的用户地址", "err", err)
+		return nil
+	}
+	service, err := netip.ParseAddrPort(info.Client.ServiceAddr)
+	if err != nil {
+		if service, err = netip.ParseAddrPort(local.String()); err != nil {
+			log.Warn("无法抓包，无效的服务地址", "err", err)
+			return nil
+		}
+	}
+
+	name := fmt.Sprintf("%s-%s-%d.pcapng", info.CreatedAt.Format("20060102-150405"), safeFileName(info.Tunnel.Name), info.CID)
+	path := filepath.Join(s.CaptureDir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		log.Warn("无法创建抓包文件", "err", err)
+		return nil
+	}
+	comment := fmt.Sprintf("tunnel=%s client=%s cid=%d time=%s",
+		info.Tunnel.Name, info.Client.Name, info.CID, info.CreatedAt.Format(time.RFC3339))
+	flow, err := pcapng.NewFlow(f, info.Tunnel.ServiceProtocol, user, service, comment)
+	if err != nil {
+		f.Close()
+		log.Warn("无法创建抓包文件", "err", err)
+		return nil
+	}
+	log.Debug("开始抓包", "path", path)
+	return flow
+}
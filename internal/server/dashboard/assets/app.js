@@ -0,0 +1,151 @@
+"use strict";
+
+// 每次刷新的间隔和流量图保留的采样数
+const INTERVAL = 2000;
+const SAMPLES = 60;
+
+// 以 "类型:名称" 为键保存上一次的字节数和速率历史
+const history = new Map();
+
+function el(tag, text, cls) {
+  const e = document.createElement(tag);
+  if (text !== undefined) e.textContent = text;
+  if (cls) e.className = cls;
+  return e;
+}
+
+function bytes(n) {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return (i ? n.toFixed(1) : n) + " " + units[i];
+}
+
+function duration(seconds) {
+  seconds = Math.floor(seconds);
+  const d = Math.floor(seconds / 86400), h = Math.floor(seconds % 86400 / 3600);
+  const m = Math.floor(seconds % 3600 / 60), s = seconds % 60;
+  if (d) return t("%s天%s时", d, h);
+  if (h) return t("%s时%s分", h, m);
+  if (m) return t("%s分%s秒", m, s);
+  return t("%s秒", s);
+}
+
+// record 根据累计字节数计算速率，返回该键的速率历史
+function record(key, up, down, seen) {
+  seen.add(key);
+  let h = history.get(key);
+  if (!h) {
+    h = {up: up, down: down, rates: []};
+    history.set(key, h);
+    return h;
+  }
+  const secs = INTERVAL / 1000;
+  h.rates.push([(up - h.up) / secs, (down - h.down) / secs]);
+  if (h.rates.length > SAMPLES) h.rates.shift();
+  h.up = up;
+  h.down = down;
+  return h;
+}
+
+// sparkline 绘制上行（蓝）和下行（绿）速率的折线图
+function sparkline(h) {
+  const c = el("canvas");
+  c.width = 160;
+  c.height = 32;
+  const ctx = c.getContext("2d");
+  const max = Math.max(1, ...h.rates.flat());
+  [[0, "#3b82f6"], [1, "#10b981"]].forEach(([idx, color]) => {
+    ctx.strokeStyle = color;
+    ctx.beginPath();
+    h.rates.forEach((r, i) => {
+      const x = c.width - (h.rates.length - 1 - i) * (c.width / (SAMPLES - 1));
+      const y = c.height - 1 - r[idx] / max * (c.height - 2);
+      i ? ctx.lineTo(x, y) : ctx.moveTo(x, y);
+    });
+    ctx.stroke();
+  });
+  const last = h.rates[h.rates.length - 1] || [0, 0];
+  c.title = t("上行 %s/s，下行 %s/s", bytes(last[0]), bytes(last[1]));
+  return c;
+}
+
+function status(ok) {
+  return el("span", "●", ok ? "ok" : "bad");
+}
+
+function row(cells) {
+  const tr = el("tr");
+  cells.forEach(c => {
+    const td = el("td");
+    c instanceof Node ? td.appendChild(c) : (td.textContent = c);
+    tr.appendChild(td);
+  });
+  return tr;
+}
+
+function fill(id, rows, empty) {
+  const tbody = document.getElementById(id);
+  tbody.replaceChildren(...rows);
+  if (!rows.length) {
+    const td = el("td", empty, "empty");
+    td.colSpan = tbody.parentElement.tHead.rows[0].cells.length;
+    const tr = el("tr");
+    tr.appendChild(td);
+    tbody.appendChild(tr);
+  }
+}
+
+async function get(path) {
+  const resp = await fetch(path, {credentials: "same-origin"});
+  if (resp.status === 401) {
+    location.href = "/login";
+    throw new Error(t("未登录"));
+  }
+  return resp.json();
+}
+
+async function refresh() {
+  const [tunnels, clients, conns, events] = await Promise.all([
+    get("/api/tunnels"), get("/api/clients"), get("/api/conns"), get("/api/events?n=50"),
+  ]);
+  const seen = new Set();
+  const now = Date.now();
+
+  fill("tunnels", tunnels.map(tun => row([
+    status(tun.enabled && tun.clients.length > 0), tun.name, tun.addr, tun.protocol,
+    tun.clients.join(", ") || t("无"), tun.active_conns, bytes(tun.bytes_up), bytes(tun.bytes_down),
+    sparkline(record("tunnel:" + tun.name, tun.bytes_up, tun.bytes_down, seen)),
+  ])), t("没有隧道"));
+
+  fill("clients", clients.map(c => row([
+    status(c.healthy), c.name, c.tunnel, c.addr, c.active_conns,
+    c.rtt_ms ? c.rtt_ms.toFixed(2) + " ms" : "-", duration((now - Date.parse(c.connected_at)) / 1000),
+  ])), t("没有已连接的srp-client"));
+
+  fill("conns", conns.map(c => row([
+    c.cid, c.tunnel, c.client, c.user_addr, c.protocol, bytes(c.bytes_up), bytes(c.bytes_down),
+    duration(c.age_seconds), sparkline(record("conn:" + c.cid, c.bytes_up, c.bytes_down, seen)),
+  ])), t("没有用户连接"));
+
+  fill("events", events.reverse().map(e => row([
+    new Date(e.time).toLocaleString(), e.type, e.tunnel || "", e.client || "", e.cid || "", e.message,
+  ])), t("没有事件"));
+
+  // 清理已关闭连接的流量历史
+  for (const key of history.keys()) {
+    if (!seen.has(key)) history.delete(key);
+  }
+  document.getElementById("updated").textContent = t("更新于 %s", new Date().toLocaleTimeString());
+}
+
+function loop() {
+  refresh().catch(err => {
+    document.getElementById("updated").textContent = t("更新失败：%s", err.message);
+  }).finally(() => setTimeout(loop, INTERVAL));
+}
+
+localeReady.then(loop);
@@ -0,0 +1,22 @@
+"use strict";
+
+// 由 srp-server 按其语言提供的控制台文本，键为中文原文，缺少翻译时显示原文
+let messages = {};
+
+// t 返回 s 在当前语言下的文本，依次以 args 替换其中的 %s
+function t(s, ...args) {
+  let i = 0;
+  return (messages[s] || s).replace(/%s/g, () => args[i++]);
+}
+
+// 翻译带有 data-i18n 属性的元素的文本，加载失败时保留原文
+const localeReady = fetch("/locale.json", {credentials: "same-origin"})
+  .then(resp => resp.json())
+  .then(locale => {
+    messages = locale.messages;
+    document.documentElement.lang = locale.lang;
+    document.querySelectorAll("[data-i18n]").forEach(e => {
+      e.textContent = t(e.textContent);
+    });
+  })
+  .catch(() => {});
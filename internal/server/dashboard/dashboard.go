@@ -0,0 +1,216 @@
+package dashboard
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"srp/pkg/i18n"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed assets
+var assets embed.FS
+
+const (
+	cookieName = "srp_session"
+	sessionTTL = 12 * time.Hour
+
+	// 同一 IP 连续登录失败 maxLoginFailures 次后在 loginLockout 内拒绝其登录
+	maxLoginFailures = 5
+	loginLockout     = 5 * time.Minute
+)
+
+// localeMessages 为页面中需要翻译的文本，以中文原文为键，由 /locale.json 按 srp-server 的语言提供给页面
+var localeMessages = []string{
+	// login.html
+	"srp-server 登录", "用户名或密码错误", "登录失败次数过多，请稍后重试", "用户名", "密码", "登录",
+	// index.html
+	"srp-server 控制台", "退出", "隧道", "用户连接", "最近事件",
+	"状态", "名称", "地址", "协议类型", "连接数", "上行", "下行", "流量", "往返时延", "在线时长",
+	"用户地址", "存活时间", "时间", "类型", "内容",
+	// app.js
+	"%s天%s时", "%s时%s分", "%s分%s秒", "%s秒", "上行 %s/s，下行 %s/s", "未登录", "无",
+	"没有隧道", "没有已连接的srp-client", "没有用户连接", "没有事件", "更新于 %s", "更新失败：%s",
+}
+
+// Dashboard 为 srp-server 的网页控制台，登录后只读地访问管理接口
+type Dashboard struct {
+	api      http.Handler // 管理接口，不再进行令牌验证
+	user     string
+	password string
+
+	mu       sync.Mutex
+	sessions map[string]time.Time          // 会话令牌到过期时间的映射
+	failures map[netip.Addr]*loginFailures // 每个 IP 的登录失败记录
+}
+
+// loginFailures 为一个 IP 连续登录失败的记录
+type loginFailures struct {
+	count int
+	last  time.Time // 最近一次失败的时间，超过 loginLockout 后重新计数
+}
+
+// New 返回网页控制台，api 为管理接口的 http.Handler
+func New(api http.Handler, user, password string) *Dashboard {
+	return &Dashboard{
+		api:      api,
+		user:     user,
+		password: password,
+		sessions: make(map[string]time.Time),
+		failures: make(map[netip.Addr]*loginFailures),
+	}
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/login":
+		d.login(w, r)
+		return
+	case "/logout":
+		d.logout(w, r)
+		return
+	case "/style.css", "/locale.js":
+		// 登录页也需要样式和翻译
+		http.ServeFileFS(w, r, assets, "assets"+r.URL.Path)
+		return
+	case "/locale.json":
+		serveLocale(w)
+		return
+	}
+
+	if !d.authorized(r) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			http.Error(w, i18n.T("未登录"), http.StatusUnauthorized)
+		} else {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		// 控制台只用于查看状态，不允许修改
+		if r.Method != http.MethodGet {
+			http.Error(w, i18n.T("控制台为只读"), http.StatusMethodNotAllowed)
+			return
+		}
+		d.api.ServeHTTP(w, r)
+		return
+	}
+	static, _ := fs.Sub(assets, "assets")
+	http.FileServerFS(static).ServeHTTP(w, r)
+}
+
+func (d *Dashboard) login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.ServeFileFS(w, r, assets, "assets/login.html")
+		return
+	}
+	// 锁定期间不再验证，并发的请求也无法绕过
+	ip := remoteIP(r)
+	if !d.allowLogin(ip) {
+		http.Redirect(w, r, "/login?locked=1", http.StatusFound)
+		return
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(r.PostFormValue("user")), []byte(d.user)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(r.PostFormValue("password")), []byte(d.password)) == 1
+	if !userOK || !passwordOK {
+		http.Redirect(w, r, "/login?failed=1", http.StatusFound)
+		return
+	}
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	d.mu.Lock()
+	now := time.Now()
+	delete(d.failures, ip)
+	for t, expiry := range d.sessions {
+		if now.After(expiry) {
+			delete(d.sessions, t)
+		}
+	}
+	d.sessions[token] = now.Add(sessionTTL)
+	d.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (d *Dashboard) logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(cookieName); err == nil {
+		d.mu.Lock()
+		delete(d.sessions, c.Value)
+		d.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: cookieName, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// serveLocale 返回当前语言和 localeMessages 在当前语言下的文本
+func serveLocale(w http.ResponseWriter) {
+	messages := make(map[string]string, len(localeMessages))
+	for _, s := range localeMessages {
+		messages[s] = i18n.T(s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"lang": i18n.Lang(), "messages": messages})
+}
+
+// allowLogin 返回 ip 是否可以尝试登录，并预先计入一次失败，验证成功后清除，
+// 使同时到达的请求不能超过剩余的尝试次数
+func (d *Dashboard) allowLogin(ip netip.Addr) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	f, ok := d.failures[ip]
+	if !ok || now.Sub(f.last) > loginLockout {
+		// 同时清理其他过期的记录
+		for k, old := range d.failures {
+			if now.Sub(old.last) > loginLockout {
+				delete(d.failures, k)
+			}
+		}
+		f = &loginFailures{}
+		d.failures[ip] = f
+	}
+	if f.count >= maxLoginFailures {
+		return false
+	}
+	f.count++
+	f.last = now
+	return true
+}
+
+// remoteIP 返回请求来源的 IP，IPv4-mapped IPv6 地址被转换为 IPv4 地址
+func remoteIP(r *http.Request) netip.Addr {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ap.Addr().Unmap().WithZone("")
+}
+
+// authorized 返回请求是否携带有效的会话
+func (d *Dashboard) authorized(r *http.Request) bool {
+	c, err := r.Cookie(cookieName)
+	if err != nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	expiry, ok := d.sessions[c.Value]
+	return ok && time.Now().Before(expiry)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	EventClientConnected    = "client_connected"
+	EventClientDisconnected = "client_disconnected"
+	EventClientRejected     = "client_rejected"
+	EventClientHealth       = "client_health"
+	EventConnOpened         = "conn_opened"
+	EventConnClosed         = "conn_closed"
+	EventConnRejected       = "conn_rejected"
+	EventAdmin              = "admin"
+	EventReload             = "reload"
+)
+
+// Event 为 srp-server 运行中发生的事件
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Tunnel  string    `json:"tunnel,omitempty"`
+	Client  string    `json:"client,omitempty"`
+	CID     uint32    `json:"cid,omitempty"`
+	Message string    `json:"message"`
+}
+
+// EventLog 以环形缓冲区保存最近的事件，并将新事件推送给订阅者
+type EventLog struct {
+	mu     sync.Mutex
+	events []Event
+	next   int  // 下一个事件写入的位置
+	full   bool // 缓冲区是否已写满
+	subs   map[chan Event]struct{}
+}
+
+// NewEventLog 返回最多保存 size 个事件的 EventLog
+func NewEventLog(size int) *EventLog {
+	return &EventLog{
+		events: make([]Event, size),
+		subs:   make(map[chan Event]struct{}),
+	}
+}
+
+// Add 记录事件，订阅者处理不及时时丢弃推送给它的事件
+func (l *EventLog) Add(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+	for ch := range l.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Recent 按时间顺序返回最近的 n 个事件，n <= 0 时返回所有保存的事件
+func (l *EventLog) Recent(n int) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := []Event{}
+	if l.full {
+		events = append(events, l.events[l.next:]...)
+	}
+	events = append(events, l.events[:l.next]...)
+	if n > 0 && len(events) > n {
+		events = events[len(events)-n:]
+	}
+	return events
+}
+
+// Subscribe 订阅新事件，调用返回的函数取消订阅
+func (l *EventLog) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+	l.mu.Lock()
+	l.subs[ch] = struct{}{}
+	l.mu.Unlock()
+	return ch, func() {
+		l.mu.Lock()
+		delete(l.subs, ch)
+		l.mu.Unlock()
+	}
+}
+
+// AddEvent 记录事件
+func (s *Server) AddEvent(typ string, tunnel string, client string, cid uint32, message string) {
+	s.Events.Add(Event{
+		Type:    typ,
+		Tunnel:  tunnel,
+		Client:  client,
+		CID:     cid,
+		Message: message,
+	})
+}
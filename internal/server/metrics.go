@@ -0,0 +1,126 @@
+package server
+
+import (
+	"srp/internal/common"
+	"srp/internal/server/wrappers"
+	"srp/pkg/metrics"
+	"sync/atomic"
+)
+
+// RegisterMetrics 注册 srp-server 的指标，指标在抓取时从当前状态计算
+func (s *Server) RegisterMetrics(r *metrics.Registry) {
+	r.Gauge("srp_server_clients", "隧道中已连接的srp-client数", func() []metrics.Sample {
+		s.RWMu.RLock()
+		defer s.RWMu.RUnlock()
+		var samples []metrics.Sample
+		for _, t := range s.SortedTunnels() {
+			samples = append(samples, metrics.Value(float64(len(t.Clients)), "tunnel", t.Name))
+		}
+		return samples
+	})
+	r.Gauge("srp_server_client_healthy", "srp-client报告的服务健康状态，1为健康", func() []metrics.Sample {
+		return s.collectClients(func(c *ClientSession) float64 {
+			if c.Healthy() {
+				return 1
+			}
+			return 0
+		})
+	})
+	r.Gauge("srp_server_client_rtt_seconds", "心跳测得的控制连接往返时延", func() []metrics.Sample {
+		return s.collectClients(func(c *ClientSession) float64 {
+			return c.RTT().Seconds()
+		})
+	})
+	r.Gauge("srp_server_client_active_conns", "srp-client承载的用户连接数", func() []metrics.Sample {
+		return s.collectClients(func(c *ClientSession) float64 {
+			return float64(c.Active())
+		})
+	})
+	r.Gauge("srp_server_active_conns", "隧道中活跃的用户连接（cid）数", func() []metrics.Sample {
+		active, _ := s.countUserConns()
+		return s.collectTunnelCounts(active)
+	})
+	r.Gauge("srp_server_udp_sessions", "隧道中活跃的UDP会话数", func() []metrics.Sample {
+		_, udp := s.countUserConns()
+		return s.collectTunnelCounts(udp)
+	})
+	r.Counter("srp_server_accepted_conns_total", "接受的用户连接数", func() []metrics.Sample {
+		return s.collectTunnels(func(t *Tunnel) float64 {
+			return float64(atomic.LoadUint64(&t.AcceptedConns))
+		})
+	})
+	r.Counter("srp_server_rejected_conns_total", "被访问控制规则或连接数限制拒绝的用户连接数", func() []metrics.Sample {
+		return s.collectTunnels(func(t *Tunnel) float64 {
+			return float64(atomic.LoadUint64(&t.RejectedConns))
+		})
+	})
+	r.Counter("srp_server_bytes_total", "转发的有效载荷字节数，up为user到服务，down为服务到user", func() []metrics.Sample {
+		var samples []metrics.Sample
+		for _, t := range s.SortedTunnels() {
+			st := t.Stats.Snapshot()
+			samples = append(samples,
+				metrics.Value(float64(st.BytesUp), "tunnel", t.Name, "direction", "up"),
+				metrics.Value(float64(st.BytesDown), "tunnel", t.Name, "direction", "down"))
+		}
+		return samples
+	})
+	r.Counter("srp_server_frames_total", "和srp-client之间收发的协议帧数", func() []metrics.Sample {
+		var samples []metrics.Sample
+		for _, t := range s.SortedTunnels() {
+			st := t.Stats.Snapshot()
+			samples = append(samples,
+				metrics.Value(float64(st.FramesIn), "tunnel", t.Name, "direction", "in"),
+				metrics.Value(float64(st.FramesOut), "tunnel", t.Name, "direction", "out"))
+		}
+		return samples
+	})
+	r.Counter("srp_server_handshake_failures_total", "srp-client验证失败的次数", func() []metrics.Sample {
+		return []metrics.Sample{metrics.Value(float64(atomic.LoadUint64(&s.HandshakeFailures)))}
+	})
+	r.Gauge("srp_server_info", "srp-server版本信息", func() []metrics.Sample {
+		return []metrics.Sample{metrics.Value(1, "version", common.Version)}
+	})
+}
+
+// collectTunnels 对每个隧道计算一个样本
+func (s *Server) collectTunnels(value func(t *Tunnel) float64) []metrics.Sample {
+	var samples []metrics.Sample
+	for _, t := range s.SortedTunnels() {
+		samples = append(samples, metrics.Value(value(t), "tunnel", t.Name))
+	}
+	return samples
+}
+
+// collectTunnelCounts 将按隧道名称统计的数量转换为样本，没有连接的隧道为 0
+func (s *Server) collectTunnelCounts(counts map[string]int) []metrics.Sample {
+	return s.collectTunnels(func(t *Tunnel) float64 {
+		return float64(counts[t.Name])
+	})
+}
+
+// collectClients 对每个 srp-client 计算一个样本
+func (s *Server) collectClients(value func(c *ClientSession) float64) []metrics.Sample {
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	var samples []metrics.Sample
+	for _, t := range s.SortedTunnels() {
+		for _, c := range t.Clients {
+			samples = append(samples, metrics.Value(value(c), "tunnel", t.Name, "client", c.Name))
+		}
+	}
+	return samples
+}
+
+// countUserConns 按隧道统计活跃的用户连接数和其中的 UDP 会话数
+func (s *Server) countUserConns() (active, udp map[string]int) {
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	active, udp = make(map[string]int), make(map[string]int)
+	for cid, info := range s.UserConnInfoMap {
+		active[info.Tunnel.Name]++
+		if _, ok := s.UserConnIDMap[cid].(*wrappers.UDPWrapper); ok {
+			udp[info.Tunnel.Name]++
+		}
+	}
+	return active, udp
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"srp/internal/common"
+	"sync"
+)
+
+const (
+	// downQueueHigh 为发往一个用户连接的积压数据量，超过后请求 srp-client 暂停该连接，
+	// 不支持流量控制的 srp-client 则阻塞读取控制连接直到积压减少
+	downQueueHigh = 1 << 20
+	// downQueueLow 为请求暂停后恢复该连接的积压数据量
+	downQueueLow = downQueueHigh / 4
+	// downQueueMax 为支持流量控制时允许的最大积压数据量，需容纳暂停前已经发出的数据，
+	// srp-client 暂停后仍持续发送时断开该用户连接
+	downQueueMax = 16 * downQueueHigh
+)
+
+// downQueue 为 srp-client 发往一个用户连接的数据队列，读取控制连接的 goroutine 只入队，
+// 由该用户连接的写入 goroutine 按下行限速写入，限速等待不会阻塞同一控制连接上的其他帧
+type downQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	frames []common.Proto
+	bytes  int  // 队列中有效载荷的总长度
+	flow   bool // srp-client 是否支持流量控制
+	paused bool // 已请求 srp-client 暂停发送
+	closed bool
+}
+
+func newDownQueue(flow bool) *downQueue {
+	q := &downQueue{flow: flow}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push 将 p 放入队列，返回是否需要请求 srp-client 暂停，以及积压是否超过上限，
+// 不支持流量控制时积压超过 downQueueHigh 后阻塞，队列已关闭时归还 p 的有效载荷
+func (q *downQueue) push(p common.Proto) (pause, overflow bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.flow && !q.closed && q.bytes >= downQueueHigh {
+		q.cond.Wait()
+	}
+	if q.closed {
+		p.Release()
+		return false, false
+	}
+	q.frames = append(q.frames, p)
+	q.bytes += len(p.Payload)
+	q.cond.Broadcast()
+	if q.flow && !q.paused && q.bytes >= downQueueHigh {
+		q.paused = true
+		pause = true
+	}
+	return pause, q.bytes > downQueueMax
+}
+
+// pop 取出队首的帧，队列为空时等待，返回是否需要请求 srp-client 恢复发送，队列关闭后返回 false
+func (q *downQueue) pop() (p common.Proto, resume, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && len(q.frames) == 0 {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return p, false, false
+	}
+	p = q.frames[0]
+	q.frames[0] = common.Proto{}
+	q.frames = q.frames[1:]
+	q.bytes -= len(p.Payload)
+	q.cond.Broadcast()
+	if q.paused && q.bytes <= downQueueLow {
+		q.paused = false
+		resume = true
+	}
+	return p, resume, true
+}
+
+// close 关闭队列并归还其中的有效载荷，唤醒等待的 push 和 pop
+func (q *downQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	for _, p := range q.frames {
+		p.Release()
+	}
+	q.frames = nil
+	q.bytes = 0
+	q.cond.Broadcast()
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"srp/internal/common"
+	"srp/internal/record"
+	"strings"
+)
+
+// startRecord 在 RecordDir 中为 srp-client 创建录制文件并录制握手，未启用录制或创建失败时返回 nil，
+// 录制的 TypePing 中不包含密码
+func (s *Server) startRecord(client *ClientSession, ping common.PingPayload, pong common.Proto) *record.Writer {
+	if s.RecordDir == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%s-%s-%s.srprec", client.ConnectedAt.Format("20060102-150405"),
+		safeFileName(client.Tunnel.Name), safeFileName(client.Name))
+	path := filepath.Join(s.RecordDir, name)
+	w, err := record.Create(path)
+	if err != nil {
+		client.Log.Warn("无法创建录制文件", "err", err)
+		return nil
+	}
+	ping.Password = ""
+	payload, _ := common.EncodePingPayload(ping)
+	w.Write(record.ClientToServer, common.NewProto(common.CodeSuccess, common.TypePing, 0, payload))
+	w.Write(record.ServerToClient, pong)
+	client.Log.Info("开始录制srp-client的会话", "path", path)
+	return w
+}
+
+// safeFileName 将文件名中的路径分隔符等字符替换为 _
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"reflect"
+	"srp/pkg/i18n"
+	"srp/pkg/logger"
+	"strings"
+)
+
+// ReloadResult 为重新加载隧道配置的结果
+type ReloadResult struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Updated   []string `json:"updated"`   // 原地更新配置的隧道
+	Restarted []string `json:"restarted"` // 协议变化而重建的隧道
+	Unchanged []string `json:"unchanged"`
+}
+
+// LoadTunnelFile 读取隧道配置文件，每行为一个格式同 -tunnel 参数的隧道配置，
+// 忽略空行和以 # 开头的注释行
+func LoadTunnelFile(path string, base TunnelConfig) ([]TunnelConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var configs []TunnelConfig
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tc, err := ParseTunnelConfig(line, base)
+		if err != nil {
+			return nil, i18n.Errorf("%s第%d行：%w", path, n, err)
+		}
+		if names[tc.Name] {
+			return nil, i18n.Errorf("%s第%d行：隧道名称重复：%s", path, n, tc.Name)
+		}
+		names[tc.Name] = true
+		configs = append(configs, tc)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, i18n.Errorf("%s中没有隧道配置", path)
+	}
+	return configs, nil
+}
+
+// setProtocol 根据隧道的 protocol 设置监听用户地址和处理连接的函数
+// 实现新的协议时，务必在此添加代码
+func (s *Server) setProtocol(t *Tunnel) error {
+	switch t.ServiceProtocol {
+	case "tcp":
+		t.ListenUser = s.ListenUserTCP
+		t.HandleNewConn = s.HandleUserConnTCP
+		t.AcceptUserConn = s.AcceptUserConnTCP
+	case "udp":
+		t.ListenUser = s.ListenUserUDP
+		t.HandleNewConn = s.HandleUserConnUDP
+		t.AcceptUserConn = s.AcceptUserConnUDP
+	default:
+		return i18n.Errorf("不支持的协议：%s", t.ServiceProtocol)
+	}
+	return nil
+}
+
+// bindTunnel 根据配置创建隧道并监听用户地址，尚未注册到 srp-server，也未开始接受用户连接
+func (s *Server) bindTunnel(tc TunnelConfig) (*Tunnel, error) {
+	t, err := NewTunnel(tc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setProtocol(t); err != nil {
+		return nil, err
+	}
+	if err := t.ListenUser(t, tc.Addr()); err != nil {
+		return nil, i18n.Errorf("无法监听隧道%s的地址%s，%w", t.Name, tc.Addr(), err)
+	}
+	return t, nil
+}
+
+// runTunnel 注册已监听的隧道并开始接受用户连接，名称重复时关闭其监听并返回错误
+func (s *Server) runTunnel(t *Tunnel) error {
+	s.tunnelsMu.Lock()
+	if _, ok := s.Tunnels[t.Name]; ok {
+		s.tunnelsMu.Unlock()
+		t.closeListener()
+		return i18n.Errorf("隧道名称重复：%s", t.Name)
+	}
+	s.Tunnels[t.Name] = t
+	s.tunnelsMu.Unlock()
+
+	logger.Info("隧道开始监听", "tunnel", t.Name, "addr", t.Addr(), "protocol", t.ServiceProtocol)
+	go t.AcceptUserConn(t)
+	return nil
+}
+
+// StartTunnel 根据配置创建隧道，监听用户地址并开始接受用户连接
+func (s *Server) StartTunnel(tc TunnelConfig) (*Tunnel, error) {
+	if s.GetTunnel(tc.Name) != nil {
+		return nil, i18n.Errorf("隧道名称重复：%s", tc.Name)
+	}
+	t, err := s.bindTunnel(tc)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.runTunnel(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// StopTunnel 移除隧道，关闭其监听，并断开注册到该隧道的 srp-client 及其承载的用户连接
+func (s *Server) StopTunnel(t *Tunnel) {
+	s.tunnelsMu.Lock()
+	if s.Tunnels[t.Name] == t {
+		delete(s.Tunnels, t.Name)
+	}
+	s.tunnelsMu.Unlock()
+
+	t.SetEnabled(false)
+	t.closeListener()
+	s.closeTunnelClients(t)
+	logger.Info("隧道已停止", "tunnel", t.Name)
+}
+
+// UpdateTunnel 原地更新协议不变的隧道的配置，已注册的 srp-client 和已建立的用户连接不受影响，
+// 用户地址变化时先监听新的地址，成功后再关闭原来的监听，失败时隧道保持原来的配置
+func (s *Server) UpdateTunnel(t *Tunnel, tc TunnelConfig) error {
+	old := t.Policy()
+	p, err := newTunnelPolicy(tc, old)
+	if err != nil {
+		return i18n.Errorf("隧道%s：%w", t.Name, err)
+	}
+	if tc.Addr() != old.Addr() {
+		if err := t.ListenUser(t, tc.Addr()); err != nil {
+			return i18n.Errorf("无法监听隧道%s的地址%s，%w", t.Name, tc.Addr(), err)
+		}
+		logger.Info("隧道改为监听新的地址", "tunnel", t.Name, "addr", tc.Addr(), "old_addr", old.Addr())
+	}
+	t.policy.Store(p)
+	return nil
+}
+
+// ReplaceTunnel 用按配置新建的隧道替换 t，新的隧道监听成功后才停止 t，
+// 注册到 t 的 srp-client 及其用户连接会被断开，用于协议变化等无法原地更新的情况
+func (s *Server) ReplaceTunnel(t *Tunnel, tc TunnelConfig) error {
+	nt, err := s.bindTunnel(tc)
+	if err != nil {
+		return err
+	}
+	s.StopTunnel(t)
+	return s.runTunnel(nt)
+}
+
+// ReloadTunnels 重新读取隧道配置文件：启动新增的隧道，停止被删除的隧道，
+// 原地更新配置有变化的隧道，协议变化的隧道会被重建（注册到该隧道的 srp-client 会被断开），
+// 配置未变化的隧道不受影响
+func (s *Server) ReloadTunnels() (ReloadResult, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	result := ReloadResult{Added: []string{}, Removed: []string{}, Updated: []string{}, Restarted: []string{}, Unchanged: []string{}}
+	if s.TunnelFile == "" {
+		return result, i18n.Errorf("未指定隧道配置文件")
+	}
+	configs, err := LoadTunnelFile(s.TunnelFile, s.BaseTunnel)
+	if err != nil {
+		return result, err
+	}
+	// 停止任何隧道前先检查所有配置，避免配置有误时隧道被停止
+	wanted := make(map[string]TunnelConfig)
+	for _, tc := range configs {
+		t, err := NewTunnel(tc)
+		if err != nil {
+			return result, i18n.Errorf("隧道%s：%w", tc.Name, err)
+		}
+		if err := s.setProtocol(t); err != nil {
+			return result, i18n.Errorf("隧道%s：%w", tc.Name, err)
+		}
+		wanted[tc.Name] = tc
+	}
+
+	var errs []error
+	for _, t := range s.SortedTunnels() {
+		tc, ok := wanted[t.Name]
+		if ok {
+			delete(wanted, t.Name)
+		}
+		switch {
+		case !ok:
+			s.StopTunnel(t)
+			result.Removed = append(result.Removed, t.Name)
+		case reflect.DeepEqual(tc, t.Policy().TunnelConfig):
+			result.Unchanged = append(result.Unchanged, t.Name)
+		case tc.ServiceProtocol == t.ServiceProtocol:
+			if err := s.UpdateTunnel(t, tc); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			result.Updated = append(result.Updated, t.Name)
+		default:
+			if err := s.ReplaceTunnel(t, tc); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			result.Restarted = append(result.Restarted, t.Name)
+		}
+	}
+
+	for _, tc := range configs {
+		if _, ok := wanted[tc.Name]; !ok {
+			continue
+		}
+		if _, err := s.StartTunnel(tc); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result.Added = append(result.Added, tc.Name)
+	}
+
+	err = errors.Join(errs...)
+	message := i18n.Sprintf("新增%v，移除%v，更新%v，重建%v，未变化%v", result.Added, result.Removed, result.Updated, result.Restarted, result.Unchanged)
+	if err != nil {
+		message = i18n.Sprintf("%s，%s", message, err)
+		logger.Warn("重新加载隧道配置时出错", "err", err)
+	}
+	logger.Info("重新加载隧道配置", "added", result.Added, "removed", result.Removed, "updated", result.Updated, "restarted", result.Restarted, "unchanged", result.Unchanged)
+	s.AddEvent(EventReload, "", "", 0, message)
+	return result, err
+}
@@ -2,53 +2,84 @@ package server
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net"
 	"srp/internal/common"
+	"srp/internal/record"
+	"srp/internal/server/balancer"
 	"srp/internal/server/wrappers"
+	"srp/pkg/i18n"
 	"srp/pkg/logger"
+	"srp/pkg/ratelimit"
+	"srp/pkg/secure"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type Config struct {
-	ClientIP string // srp-client ip
-	UserIP   string // user ip
+	ClientIP   string // srp-client ip
+	ClientPort int    // srp-client port
 
-	ClientPort int // srp-client port
-	UserPort   int // user port
+	ServerPassword string
+	Tunnels        []TunnelConfig // 对外提供的隧道
+	TunnelFile     string         // 隧道配置文件，不为空时可重新加载
+	CaptureDir     string         // 抓包文件的目录，不为空时将每个用户连接转发的数据写入 pcapng 文件
+	RecordDir      string         // 录制文件的目录，不为空时录制每个 srp-client 会话的协议帧
+	BaseTunnel     TunnelConfig   // 隧道配置中未指定的项使用的值
 
-	ServerPassword  string
-	ServiceProtocol string // 和服务通信的协议，也为和 srp-server 通信的协议
+	MaxPayloadSize uint32        // 能够接收的协议帧有效载荷最大长度，为 0 时使用 common.DefaultMaxPayloadSize
+	ReadTimeout    time.Duration // 控制连接的读取超时时间，只在双方都支持心跳时生效，为 0 时不超时
+	FlushDelay     time.Duration // 控制连接合并写入前等待更多帧的时间，为 0 时不等待
 
-	LogLevel int
+	RequireEncryption bool // 是否拒绝未加密的 srp-client 连接
+	Obfuscate         bool // srp-client 端口是否只接受混淆模式的连接，混淆模式的连接均经过加密
 }
 
 type Server struct {
 	Config
 
-	CIDCounter    uint32
-	ClientConn    net.Conn
-	UserConnIDMap map[uint32]net.Conn // map of User Connection ID to Connection
+	CIDCounter        uint32
+	ClientCounter     uint32
+	HandshakeFailures uint64 // srp-client 验证失败的次数
 
-	DataChan2User   chan common.Proto // data channel to user
-	DataChan2Client chan common.Proto // data channel to client
+	Tunnels         map[string]*Tunnel       // map of Tunnel Name to Tunnel，由 tunnelsMu 保护
+	UserConnIDMap   map[uint32]net.Conn      // map of User Connection ID to Connection
+	UserConnInfoMap map[uint32]*UserConnInfo // map of User Connection ID to Connection Info
 
-	BufferPool sync.Pool // 缓冲区复用
-	RWMu       *sync.RWMutex
+	Events    *EventLog  // 最近的事件
+	AccessLog *AccessLog // 用户连接的访问日志，为 nil 时不记录
 
-	// 处理 SRP 客户端与服务之间连接的函数
-	// 在运行时动态根据命令行参数被赋值
-	AcceptUserConn func()
-	HandleNewConn  func(values ...interface{})
+	RWMu *sync.RWMutex
+
+	// 需要同时持有时，先获取 RWMu 再获取 tunnelsMu
+	tunnelsMu sync.RWMutex
+	reloadMu  sync.Mutex // 保证同一时间只有一次重新加载
 }
 
-func (s *Server) AddUserConn(cid uint32, conn net.Conn) {
+// AddUserConn 记录用户连接及承载该连接的 srp-client，返回该连接的信息
+func (s *Server) AddUserConn(cid uint32, conn net.Conn, client *ClientSession) *UserConnInfo {
+	info := &UserConnInfo{
+		CID:       cid,
+		Tunnel:    client.Tunnel,
+		Client:    client,
+		UserAddr:  conn.RemoteAddr(),
+		CreatedAt: time.Now(),
+		down:      newDownQueue(client.Caps.Has(common.CapFlowControl)),
+		done:      make(chan struct{}),
+	}
+	info.handshaking.Store(true)
+	info.Capture = s.startCapture(info, conn.LocalAddr())
 	s.RWMu.Lock()
 	defer s.RWMu.Unlock()
 	s.UserConnIDMap[cid] = conn
+	s.UserConnInfoMap[cid] = info
+	atomic.AddInt64(&client.activeConns, 1)
+	go s.writeUserConn(info, conn)
+	return info
 }
 
 func (s *Server) GetUserConn(cid uint32) net.Conn {
@@ -57,51 +88,160 @@ func (s *Server) GetUserConn(cid uint32) net.Conn {
 	return s.UserConnIDMap[cid]
 }
 
+// GetUserConnInfo 返回用户连接的信息
+func (s *Server) GetUserConnInfo(cid uint32) *UserConnInfo {
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	return s.UserConnInfoMap[cid]
+}
+
 func (s *Server) CloseUserConn(cid uint32) {
 	s.RWMu.Lock()
 	defer s.RWMu.Unlock()
+	s.closeUserConn(cid)
+}
+
+// CloseUserConnWithReason 记录关闭原因后关闭用户连接
+func (s *Server) CloseUserConnWithReason(cid uint32, reason string) {
+	s.RWMu.Lock()
+	defer s.RWMu.Unlock()
+	if info, ok := s.UserConnInfoMap[cid]; ok {
+		info.SetCloseReason(reason)
+	}
+	s.closeUserConn(cid)
+}
+
+// closeUserConn 调用者需持有写锁
+func (s *Server) closeUserConn(cid uint32) {
 	if conn, ok := s.UserConnIDMap[cid]; ok {
 		conn.Close()
 		delete(s.UserConnIDMap, cid)
 	}
+	if info, ok := s.UserConnInfoMap[cid]; ok {
+		info.down.close()
+		close(info.done)
+		atomic.AddInt64(&info.Client.activeConns, -1)
+		delete(s.UserConnInfoMap, cid)
+	}
 }
 
-func (s *Server) CloseClientConn() {
+// AddClient 将 srp-client 注册到隧道，名称重复时返回错误
+func (s *Server) AddClient(client *ClientSession) error {
 	s.RWMu.Lock()
 	defer s.RWMu.Unlock()
-	if s.ClientConn != nil {
-		s.ClientConn.Close()
-		s.ClientConn = nil
+	t := client.Tunnel
+	if s.GetTunnel(t.Name) != t {
+		return i18n.Errorf("隧道%s已被移除", t.Name)
+	}
+	for _, c := range t.Clients {
+		if c.Name == client.Name {
+			return i18n.Errorf("隧道%s中已存在名为%s的srp-client", t.Name, client.Name)
+		}
 	}
+	t.Clients = append(t.Clients, client)
+	return nil
 }
 
-func (s *Server) GetNextCID() uint32 {
-	return atomic.AddUint32(&s.CIDCounter, 1)
+// findSession 返回 ping 要加入的会话，会话需属于同名的 srp-client，
+// 加入的控制连接需尚未建立，直连数据连接对应的用户连接需由该会话承载，预建数据连接需会话支持
+func (s *Server) findSession(t *Tunnel, ping common.PingPayload) (*ClientSession, error) {
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	for _, c := range t.Clients {
+		if c.Name != ping.Name || c.Session == "" || c.Session != ping.Session {
+			continue
+		}
+		if ping.Pool {
+			if !c.Caps.Has(common.CapPool) {
+				return nil, i18n.Errorf("会话不支持预建数据连接")
+			}
+		} else if ping.DataCID != 0 {
+			info := s.UserConnInfoMap[ping.DataCID]
+			if _, ok := s.UserConnIDMap[ping.DataCID].(*wrappers.TCPWrapper); !ok || info.Client != c || !c.Caps.Has(common.CapDirect) {
+				return nil, i18n.Errorf("无效的cid%d", ping.DataCID)
+			}
+		} else if ping.Link >= len(c.links) || c.links[ping.Link].Load() != nil {
+			return nil, i18n.Errorf("无效的控制连接序号%d，会话的控制连接数为%d", ping.Link, len(c.links))
+		}
+		return c, nil
+	}
+	return nil, i18n.Errorf("隧道%s中不存在srp-client %s的会话", t.Name, ping.Name)
 }
 
-func (s *Server) CloseAllUserConn() {
+// CloseClientConn 断开 srp-client 的连接，将其从隧道中移除，并关闭其承载的所有用户连接
+func (s *Server) CloseClientConn(client *ClientSession) {
 	s.RWMu.Lock()
 	defer s.RWMu.Unlock()
-	for _, c := range s.UserConnIDMap {
-		c.Close()
+	for _, l := range client.Links() {
+		l.Conn.Close()
+	}
+	client.closePool()
+	t := client.Tunnel
+	for i, c := range t.Clients {
+		if c == client {
+			t.Clients = append(t.Clients[:i:i], t.Clients[i+1:]...)
+			break
+		}
+	}
+	for cid, info := range s.UserConnInfoMap {
+		if info.Client == client {
+			info.SetCloseReason(i18n.T("srp-client断开连接"))
+			s.closeUserConn(cid)
+		}
 	}
-	s.UserConnIDMap = make(map[uint32]net.Conn)
+}
+
+// CloseAllClientConn 断开所有 srp-client 的连接
+func (s *Server) CloseAllClientConn() {
+	for _, t := range s.SortedTunnels() {
+		s.closeTunnelClients(t)
+	}
+}
+
+// closeTunnelClients 断开注册到隧道的所有 srp-client
+func (s *Server) closeTunnelClients(t *Tunnel) {
+	s.RWMu.RLock()
+	clients := append([]*ClientSession(nil), t.Clients...)
+	s.RWMu.RUnlock()
+	for _, c := range clients {
+		s.CloseClientConn(c)
+	}
+}
+
+// PickClient 根据隧道的负载均衡策略为用户连接选择 srp-client，跳过服务不健康的 srp-client
+func (s *Server) PickClient(t *Tunnel, userAddr net.Addr) *ClientSession {
+	s.RWMu.RLock()
+	nodes := make([]balancer.Node, 0, len(t.Clients))
+	for _, c := range t.Clients {
+		if c.Healthy() && c.Ready() {
+			nodes = append(nodes, c)
+		}
+	}
+	s.RWMu.RUnlock()
+	if n := t.Policy().Balancer.Pick(nodes, userAddr); n != nil {
+		return n.(*ClientSession)
+	}
+	return nil
+}
+
+func (s *Server) GetNextCID() uint32 {
+	return atomic.AddUint32(&s.CIDCounter, 1)
 }
 
 func (s *Server) AcceptClient() {
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.ClientIP, s.ClientPort))
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.ClientIP, strconv.Itoa(s.ClientPort)))
 	if err != nil {
-		log.Fatal("无法创建tcp监听，" + err.Error())
+		logger.Fatal("无法创建tcp监听", "err", err)
 	}
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝srp-client：%s的连接，%s", conn.RemoteAddr(), err))
+			logger.Warn("无法接受srp-client的连接", "err", err)
 			continue
 		}
-		logger.LogWithLevel(s.LogLevel, 1, fmt.Sprintf("开始处理srp-client：%s的连接", conn.RemoteAddr()))
-		s.HandleClient(conn)
+		logger.Info("开始处理srp-client的连接", "client_addr", conn.RemoteAddr().String())
+		go s.HandleClient(conn)
 	}
 }
 
@@ -111,119 +251,547 @@ func (s *Server) HandleClient(conn net.Conn) {
 	data := common.Proto{}
 	reader := bufio.NewReader(conn)
 	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
-	if err := data.DecodeProto(reader); err != nil {
+	rawConn := conn
+	encrypted := false
+	var err error
+	// 混淆模式下以混淆握手交换密钥，之后的数据均经过加密
+	if s.Obfuscate {
+		var sc net.Conn
+		if sc, err = s.obfsHandshake(conn, reader); err == nil {
+			conn, encrypted = sc, true
+			reader = bufio.NewReader(conn)
+		}
+	}
+	// 验证前只接受握手大小的帧
+	if err == nil {
+		err = data.DecodeProtoLimit(reader, common.MaxHandshakePayloadSize)
+	}
+	// srp-client 启用加密时先交换密钥，之后的数据均经过加密，密码错误时无法解密 TypePing
+	if err == nil && !encrypted && data.Type == common.TypeKeyExchange {
+		var sc net.Conn
+		if sc, err = s.keyExchange(conn, reader, data.Payload); err == nil {
+			conn, encrypted = sc, true
+			reader = bufio.NewReader(conn)
+			err = data.DecodeProtoLimit(reader, common.MaxHandshakePayloadSize)
+		}
+	}
+	if err != nil {
+		// 混淆模式下读取到超时再断开，主动探测无法根据断开的时机识别 srp-server
+		if s.Obfuscate {
+			io.Copy(io.Discard, rawConn)
+		}
 		conn.Close()
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝srp-client：%s的连接，%s", conn.RemoteAddr(), err))
+		atomic.AddUint64(&s.HandshakeFailures, 1)
+		logger.Warn("拒绝srp-client的连接，无法读取验证信息", "client_addr", conn.RemoteAddr().String(), "err", err)
 		return
 	}
 
-	if data.Type != common.TypePing || string(data.Payload) != s.ServerPassword {
-		data = common.NewProto(common.CodeForbidden, common.TypePong, 0, []byte("连接失败，密码错误"))
-		logger.LogWithLevel(s.LogLevel, 1, fmt.Sprintf("拒绝srp-client：%s的连接，密码错误", conn.RemoteAddr()))
+	ping := common.DecodePingPayload(data.Payload)
+	client := &ClientSession{
+		ID:     atomic.AddUint32(&s.ClientCounter, 1),
+		Name:   ping.Name,
+		Tunnel: s.GetTunnel(ping.Tunnel),
+		Link:   &Link{Conn: conn, Writer: common.NewFrameWriter(conn, s.FlushDelay)},
+
+		Session: ping.Session,
+
+		ServiceAddr: ping.Service,
+		Caps:        ping.Capabilities & common.Capabilities,
+		MaxPayload:  ping.MaxPayload,
+		Encrypted:   encrypted,
+
+		ConnectedAt: time.Now(),
+	}
+	version, versionErr := common.NegotiateVersion(ping.Version, ping.MinVersion)
+	client.Version = version
+	// 隧道配置了压缩且 srp-client 支持时才压缩，需在注册到隧道前确定
+	if client.Tunnel != nil && client.Tunnel.Policy().Compression == common.CompressionDeflate && client.Caps.Has(common.CapCompression) {
+		client.Compression = common.CompressionDeflate
+	}
+	// 双方都支持时按 srp-client 的要求使用多条控制连接，需在注册到隧道前确定
+	conns := 1
+	if client.Caps.Has(common.CapMultiConn) && ping.Conns > 1 {
+		conns = min(ping.Conns, common.MaxControlConns)
+	}
+	client.links = make([]atomic.Pointer[Link], conns)
+	client.links[0].Store(client.Link)
+	if client.Name == "" {
+		client.Name = conn.RemoteAddr().String()
+	}
+	client.Log = logger.With("tunnel", ping.Tunnel, "client", client.Name, "client_addr", conn.RemoteAddr().String())
+	var joined *ClientSession // ping.Link 大于 0 时要加入的会话
+	if s.RequireEncryption && !encrypted {
+		data = common.NewProto(common.CodeForbidden, common.TypePong, 0, []byte(i18n.T("连接失败，srp-server要求加密连接，请使用-encrypt参数")))
+		client.Log.Info("拒绝srp-client的连接，未加密")
+	} else if data.Type != common.TypePing || ping.Password != s.ServerPassword {
+		data = common.NewProto(common.CodeForbidden, common.TypePong, 0, []byte(i18n.T("连接失败，密码错误")))
+		client.Log.Info("拒绝srp-client的连接，密码错误")
+	} else if versionErr != nil {
+		data = common.NewProto(common.CodeForbidden, common.TypePong, 0, []byte(i18n.Sprintf("连接失败，%s", versionErr)))
+		client.Log.Info("拒绝srp-client的连接", "err", versionErr)
+	} else if client.Tunnel == nil {
+		data = common.NewProto(common.CodeForbidden, common.TypePong, 0, []byte(i18n.Sprintf("连接失败，隧道不存在：%s", ping.Tunnel)))
+		client.Log.Info("拒绝srp-client的连接，隧道不存在")
+	} else if ping.Link > 0 || ping.DataCID != 0 || ping.Pool {
+		// 会话的其余控制连接、直连数据连接和预建数据连接加入已有的会话，不注册新的 srp-client
+		if joined, err = s.findSession(client.Tunnel, ping); err != nil {
+			data = common.NewProto(common.CodeForbidden, common.TypePong, 0, []byte(i18n.Sprintf("连接失败，%s", err)))
+			client.Log.Info("拒绝srp-client的连接", "err", err)
+		} else {
+			data = common.NewProto(common.CodeSuccess, common.TypePong, 0, joined.pongPayload(s.maxPayloadSize()))
+		}
+	} else if err := s.AddClient(client); err != nil {
+		data = common.NewProto(common.CodeForbidden, common.TypePong, 0, []byte(i18n.Sprintf("连接失败，%s", err)))
+		client.Log.Info("拒绝srp-client的连接", "err", err)
 	} else {
-		data = common.NewProto(common.CodeSuccess, common.TypePong, 0, []byte("连接成功"))
+		clientRate := client.Tunnel.Policy().ClientRate
+		client.UpBucket = clientRate.NewBucket()
+		client.DownBucket = clientRate.NewBucket()
+		data = common.NewProto(common.CodeSuccess, common.TypePong, 0, client.pongPayload(s.maxPayloadSize()))
 	}
 
-	// 发送 pong
-	dataByte, err := data.EncodeProto()
-	if err != nil {
+	// 在连接密码不正确或其他情况时，发送 pong 后断开连接
+	if data.Code == common.CodeForbidden {
+		atomic.AddUint64(&s.HandshakeFailures, 1)
+		s.AddEvent(EventClientRejected, ping.Tunnel, client.Name, 0, i18n.Sprintf("%s：%s", conn.RemoteAddr(), data.Payload))
+		client.Writer.Send(data)
+		client.Writer.Close()
 		conn.Close()
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝srp-client：%s的连接，无法处理数据，%s", conn.RemoteAddr(), err))
 		return
 	}
-	if _, err = conn.Write(dataByte); err != nil {
-		conn.Close()
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝srp-client：%s的连接，无法发送数据，%s", conn.RemoteAddr(), err))
+	if joined != nil && ping.Pool {
+		s.servePooledConn(joined, client.Link, reader, data)
+		return
+	} else if joined != nil && ping.DataCID != 0 {
+		s.serveDirectConn(joined, ping.DataCID, client.Link, reader, data)
+		return
+	} else if joined != nil {
+		s.serveJoinedLink(joined, ping.Link, client.Link, reader, data)
 		return
 	}
+	defer s.CloseClientConn(client)
+	// 在关闭连接前写入队列中剩余的帧
+	defer client.Writer.Close()
 
-	// 在连接密码不正确或其他情况时，断开连接
-	if data.Code == common.CodeForbidden {
-		conn.Close()
+	// 发送 pong
+	if err := client.Writer.Send(data); err != nil {
+		client.Log.Warn("拒绝srp-client的连接，无法发送数据", "err", err)
 		return
 	}
 
-	// 记录连接
-	s.ClientConn = conn
+	client.recorder.Store(s.startRecord(client, ping, data))
+	defer client.recorder.Load().Close()
+
 	conn.SetReadDeadline(time.Time{})
-	logger.LogWithLevel(s.LogLevel, 1, fmt.Sprintf("成功建立与srp-client：%s的连接", conn.RemoteAddr()))
+	client.Log.Info("成功建立与srp-client的连接", "version", client.Version, "capabilities", client.Caps, "compression", client.Compression, "encrypted", client.Encrypted, "conns", len(client.links))
+	s.AddEvent(EventClientConnected, client.Tunnel.Name, client.Name, 0, conn.RemoteAddr().String())
+	if client.Caps.Has(common.CapHeartbeat) {
+		go s.SendHeartbeat(client)
+	}
+
+	s.readClientFrames(client, client.Link, reader)
+}
+
+// serveJoinedLink 处理加入会话的第 i 条控制连接，该连接断开时断开整个会话
+func (s *Server) serveJoinedLink(client *ClientSession, i int, link *Link, reader *bufio.Reader, pong common.Proto) {
+	defer s.CloseClientConn(client)
+	defer link.Writer.Close()
+	// 发送 pong 后才加入会话，之前不会有其他帧经由该连接发送
+	err := link.Writer.Send(pong)
+	if err == nil {
+		err = client.join(i, link)
+	}
+	if err != nil {
+		client.Log.Warn("srp-client的控制连接无法加入会话", "link", i, "err", err)
+		link.Conn.Close()
+		return
+	}
+	link.Conn.SetReadDeadline(time.Time{})
+	client.Log.Info("srp-client的控制连接加入会话", "link", i, "link_addr", link.Conn.RemoteAddr().String())
+	s.readClientFrames(client, link, reader)
+}
+
+// serveDirectConn 发送 pong 后将直连数据连接交给等待中的用户连接，之后由用户连接的处理直接转发原始字节
+func (s *Server) serveDirectConn(client *ClientSession, cid uint32, link *Link, reader *bufio.Reader, pong common.Proto) {
+	if err := detachLink(link, pong); err != nil {
+		client.Log.Warn("无法建立直连数据连接，无法发送数据", "cid", cid, "err", err)
+		link.Conn.Close()
+		return
+	}
+	w, ok := s.GetUserConn(cid).(*wrappers.TCPWrapper)
+	if !ok {
+		link.Conn.Close()
+		return
+	}
+	// 用户连接只接收一次，已经收到过时关闭
+	select {
+	case w.DirectC <- wrappers.DirectConn{Conn: link.Conn, Reader: reader}:
+	default:
+		link.Conn.Close()
+	}
+}
+
+// servePooledConn 发送 pong 后将预建数据连接放入会话的空闲连接，等待分配用户连接
+func (s *Server) servePooledConn(client *ClientSession, link *Link, reader *bufio.Reader, pong common.Proto) {
+	if err := detachLink(link, pong); err != nil {
+		client.Log.Warn("无法建立预建数据连接，无法发送数据", "err", err)
+		link.Conn.Close()
+		return
+	}
+	if !client.putPooled(wrappers.DirectConn{Conn: link.Conn, Reader: reader}) {
+		client.Log.Debug("拒绝预建数据连接，会话已断开或空闲连接已满", "max", common.MaxPoolSize)
+		link.Conn.Close()
+	}
+}
+
+// detachLink 发送 pong 并停止 link 的 Writer，取消握手时设置的读取超时，之后直接读写 link.Conn
+func detachLink(link *Link, pong common.Proto) error {
+	// pong 需在转发数据前写入完成，之后不再经由 Writer 写入
+	link.Writer.Send(pong)
+	if err := link.Writer.Close(); err != nil {
+		return err
+	}
+	return link.Conn.SetReadDeadline(time.Time{})
+}
+
+// takePooledConn 将用户连接交给 srp-client 空闲的预建数据连接：发送携带 cid 的 TypeNewConn 并等待响应，
+// 无法发送或读取响应的连接被关闭后尝试下一条。没有可用的连接或超过 NewConnTimeout 时返回 nil，
+// 由调用者经由控制连接申请；srp-client 拒绝连接时返回的 bool 为 false
+func (s *Server) takePooledConn(info *UserConnInfo, log *logger.Logger) (*wrappers.DirectConn, bool) {
+	client := info.Client
+	deadline := time.Now().Add(common.NewConnTimeout)
+	for time.Now().Before(deadline) {
+		dc, ok := client.takePooled()
+		if !ok {
+			return nil, true
+		}
+		data := common.NewProto(common.CodeSuccess, common.TypeNewConn, info.CID, nil)
+		_, err := dc.Write(data.AppendProto(nil))
+		if err == nil {
+			dc.SetReadDeadline(deadline)
+			err = data.DecodeProtoLimit(dc.Reader, common.MaxHandshakePayloadSize)
+		}
+		if err == nil {
+			err = dc.SetReadDeadline(time.Time{})
+		}
+		if err != nil {
+			log.Debug("预建数据连接断开", "err", err)
+			dc.Close()
+			continue
+		}
+		if data.Code != common.CodeSuccess || data.Type != common.TypeAcceptConn {
+			dc.Close()
+			log.Info("拒绝user的连接，srp-client拒绝连接", "err", string(data.Payload))
+			s.AddEvent(EventConnRejected, info.Tunnel.Name, client.Name, info.CID, i18n.Sprintf("%s：srp-client拒绝连接：%s", info.UserAddr, data.Payload))
+			return nil, false
+		}
+		return &dc, true
+	}
+	return nil, true
+}
 
+// readClientFrames 读取 srp-client 的一条控制连接并分类处理，连接断开或无法处理数据时返回
+func (s *Server) readClientFrames(client *ClientSession, link *Link, reader *bufio.Reader) {
+	data := common.Proto{}
 	// 接收来自 srp-client 的消息，分类处理
+	// 双方都支持心跳时 srp-client 至少每个心跳间隔发送一帧，超时未收到则认为连接已失效
+	readTimeout := s.ReadTimeout
+	if !client.Caps.Has(common.CapHeartbeat) {
+		readTimeout = 0
+	}
 	for {
-		if err = data.DecodeProto(reader); err != nil {
-			logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("与srp-client：%s的连接断开，%s", conn.RemoteAddr(), err))
-			s.CloseClientConn()
-			s.CloseAllUserConn()
-			for {
-				select {
-				case <-s.DataChan2Client:
-				case <-s.DataChan2User:
-				default:
-					return
+		if readTimeout > 0 {
+			link.Conn.SetReadDeadline(time.Now().Add(readTimeout))
+		}
+		// 转发的数据使用缓冲池，由发送到 user 后的处理归还
+		if err := data.ReadProto(reader, s.maxPayloadSize()); err != nil {
+			client.Log.Info("与srp-client的连接断开", "err", err)
+			s.AddEvent(EventClientDisconnected, client.Tunnel.Name, client.Name, 0, err.Error())
+			return
+		}
+		client.Stats.AddFrameIn()
+		client.Tunnel.Stats.AddFrameIn()
+		client.recorder.Load().Write(record.ClientToServer, data)
+		if data.Compressed {
+			d, err := common.DecompressProto(data)
+			data.Release()
+			if err != nil {
+				client.Log.Warn("与srp-client的连接断开，无法处理数据", "err", err)
+				s.AddEvent(EventClientDisconnected, client.Tunnel.Name, client.Name, 0, err.Error())
+				return
+			}
+			data = d
+		}
+		switch data.Type {
+		case common.TypeHeartbeat:
+			ack := common.NewProto(common.CodeSuccess, common.TypeHeartbeatAck, 0, data.Payload)
+			if err := s.sendDataToLink(client, link, ack); err != nil {
+				client.Log.Warn("无法响应srp-client的心跳", "err", err)
+			}
+			continue
+		case common.TypeHeartbeatAck:
+			if rtt, ok := common.HeartbeatRTT(data); ok {
+				client.SetRTT(rtt)
+				client.Log.Trace("srp-client的往返时延", "rtt", rtt)
+			}
+			continue
+		}
+		if data.Type == common.TypeHealth {
+			client.SetHealthy(data.Code == common.CodeSuccess)
+			client.Log.Info("srp-client的服务健康状态变化", "healthy", client.Healthy(), "detail", string(data.Payload))
+			s.AddEvent(EventClientHealth, client.Tunnel.Name, client.Name, 0, i18n.Sprintf("healthy=%t，%s", client.Healthy(), data.Payload))
+			continue
+		}
+		// 只接受该 srp-client 承载的用户连接的数据
+		info := s.GetUserConnInfo(data.CID)
+		if info == nil || info.Client != client {
+			client.Log.Debug("无效的cid", "cid", data.CID)
+			// 用户连接等待超时后 srp-client 才接受连接，通知其关闭服务连接
+			if info == nil && data.Type == common.TypeAcceptConn {
+				if err := s.SendDataToClient(client, common.NewProto(common.CodeSuccess, common.TypeDisconnect, data.CID, nil)); err != nil {
+					client.Log.Debug("无法向srp-client发送数据", "cid", data.CID, "err", err)
 				}
 			}
+			continue
 		}
-		if data.Type == common.TypeAcceptConn || data.Type == common.TypeRejectConn {
+		resp := data.Type == common.TypeAcceptConn || data.Type == common.TypeRejectConn
+		// 等待响应期间，srp-client 以 TypeDisconnect 表示无法建立 UDP 连接
+		if (resp || data.Type == common.TypeDisconnect) && info.endHandshake() {
 			conn := s.GetUserConn(data.CID)
 			if conn == nil {
-				logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("无效的cid：%d", data.CID))
+				client.Log.Debug("无效的cid", "cid", data.CID)
 				continue
 			}
-			// 根据不同的连接类型，向该连接的握手 chan 发送数据
+			// 根据不同的连接类型，向该连接的握手 chan 发送数据，握手 chan 容量为 1 且只发送一次，不会阻塞
 			switch c := conn.(type) {
 			case *wrappers.TCPWrapper:
 				c.HandshakeRespC <- data
 			case *wrappers.UDPWrapper:
 				c.HandshakeRespC <- data
 			default:
-				logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("未知的数据格式（cid：%d）：%T", data.CID, c))
+				client.Log.Warn("未知的数据格式", "cid", data.CID, "conn_type", fmt.Sprintf("%T", c))
+			}
+		} else if resp {
+			client.Log.Debug("忽略连接建立后的响应", "cid", data.CID, "type", data.Type)
+		} else {
+			if data.Type == common.TypeForwarding {
+				info.Stats.AddDown(int(data.PayloadLen))
+				info.Capture.Recv(data.Payload)
+				client.Stats.AddDown(int(data.PayloadLen))
+				client.Tunnel.Stats.AddDown(int(data.PayloadLen))
+			}
+			// 下行限速由该用户连接的写入 goroutine 等待，不阻塞控制连接上的其他帧
+			pause, overflow := info.down.push(data)
+			if overflow {
+				client.Log.Info("断开user的连接，srp-client暂停后仍持续发送数据", "cid", data.CID)
+				s.CloseUserConnWithReason(data.CID, i18n.T("srp-client暂停后仍持续发送数据"))
+			} else if pause {
+				if err := s.SendDataToClient(client, common.NewProto(common.CodeSuccess, common.TypePause, data.CID, nil)); err != nil {
+					client.Log.Debug("无法向srp-client发送数据", "cid", data.CID, "err", err)
+				}
 			}
+		}
+	}
+}
+
+// writeUserConn 按 srp-client 和隧道的下行限速将 srp-client 发来的数据依次写入用户连接，
+// 积压减少后请求 srp-client 恢复发送，收到 TypeDisconnect 或连接关闭后退出
+func (s *Server) writeUserConn(info *UserConnInfo, conn net.Conn) {
+	client, t := info.Client, info.Tunnel
+	for {
+		data, resume, ok := info.down.pop()
+		if !ok {
+			return
+		}
+		if data.Type == common.TypeDisconnect {
+			s.CloseUserConnWithReason(data.CID, i18n.Sprintf("srp-client：%s", data.Payload))
+			logger.Debug("关闭user的连接", "cid", data.CID, "reason", string(data.Payload))
+			return
+		}
+		ratelimit.WaitAll(int(data.PayloadLen), client.DownBucket, t.Policy().DownBucket)
+		if _, err := conn.Write(data.Payload); err != nil {
+			logger.Warn("丢弃srp-client发往user的数据包，无法发送数据", "cid", data.CID, "err", err)
 		} else {
-			s.DataChan2User <- data
+			logger.Debug("转发数据到user", "cid", data.CID, "bytes", data.PayloadLen)
+			logger.Trace("转发数据到user", "data", data)
+		}
+		// 有效载荷来自缓冲池，写入后归还
+		data.Release()
+		if resume {
+			if err := s.SendDataToClient(client, common.NewProto(common.CodeSuccess, common.TypeResume, data.CID, nil)); err != nil {
+				client.Log.Debug("无法向srp-client发送数据", "cid", data.CID, "err", err)
+			}
 		}
 	}
 }
 
-// SendDataToClient 向 srp-client 发送数据
-func (s *Server) SendDataToClient(p common.Proto) error {
-	if s.ClientConn == nil {
-		return fmt.Errorf("未建立和srp-client的连接")
+// keyExchange 回应 srp-client 的密钥交换，返回加密的连接，peer 为 srp-client 的临时公钥，
+// r 为已经用于读取 conn 的 Reader
+func (s *Server) keyExchange(conn net.Conn, r io.Reader, peer []byte) (net.Conn, error) {
+	key, err := secure.GenerateKey(s.ServerPassword)
+	if err != nil {
+		return nil, err
 	}
-	dataByte, err := p.EncodeProto()
+	keys, err := key.DeriveKeys(peer, s.ServerPassword, false)
 	if err != nil {
+		return nil, err
+	}
+	reply := common.NewProto(common.CodeSuccess, common.TypeKeyExchange, 0, key.PublicKey())
+	if _, err := conn.Write(reply.AppendProto(nil)); err != nil {
+		return nil, err
+	}
+	return secure.NewConn(conn, r, keys), nil
+}
+
+// obfsHandshake 完成与 srp-client 的混淆握手，返回混淆模式的加密连接，r 为已经用于读取 conn 的 Reader
+func (s *Server) obfsHandshake(conn net.Conn, r io.Reader) (net.Conn, error) {
+	nonce, peer, err := secure.ReadClientHello(r, s.ServerPassword)
+	if err != nil {
+		return nil, err
+	}
+	key, err := secure.GenerateObfsKey(s.ServerPassword)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := key.DeriveKeys(peer, s.ServerPassword, false)
+	if err != nil {
+		return nil, err
+	}
+	sc := secure.NewObfsConn(conn, r, keys)
+	if err := sc.WriteServerHello(key, s.ServerPassword, nonce); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// SendDataToClient 向 srp-client 发送数据，经由承载 p.CID 的控制连接发送
+func (s *Server) SendDataToClient(client *ClientSession, p common.Proto) error {
+	if client == nil {
+		return i18n.Errorf("未建立和srp-client的连接")
+	}
+	return s.sendDataToLink(client, client.LinkFor(p.CID), p)
+}
+
+// forwardToClient 将 user 发来的数据发送到承载该连接的 srp-client，并归还有效载荷的缓冲区，
+// 控制连接已断开时关闭该 srp-client 的会话
+func (s *Server) forwardToClient(client *ClientSession, p common.Proto) {
+	// 有效载荷来自缓冲池，处理完后归还
+	defer p.Release()
+	if err := s.SendDataToClient(client, p); err != nil {
+		client.Log.Warn("丢弃user发往srp-client的数据包，无法发送数据", "cid", p.CID, "err", err)
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+			s.CloseClientConn(client)
+		}
+		return
+	}
+	client.Log.Debug("转发数据到srp-client", "cid", p.CID, "bytes", p.PayloadLen)
+	client.Log.Trace("转发数据到srp-client", "data", p)
+}
+
+// sendDataToLink 经由 srp-client 的控制连接 link 发送数据
+func (s *Server) sendDataToLink(client *ClientSession, link *Link, p common.Proto) error {
+	if client.Compression != "" {
+		if c := common.CompressProto(p); c.Compressed {
+			defer c.Release()
+			p = c
+		}
+	}
+	if err := p.CheckPayloadSize(client.MaxPayload); err != nil {
+		return err
+	}
+	if err := link.Writer.Send(p); err != nil {
 		return err
 	}
-	_, err = s.ClientConn.Write(dataByte)
-	return err
+	client.Stats.AddFrameOut()
+	client.Tunnel.Stats.AddFrameOut()
+	client.recorder.Load().Write(record.ServerToClient, p)
+	return nil
 }
 
-// AcceptUserConnTCP 监听和接受 TCP 连接
-func (s *Server) AcceptUserConnTCP() {
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.UserIP, s.UserPort))
+// maxPayloadSize 返回能够接收的有效载荷最大长度
+func (s *Server) maxPayloadSize() uint32 {
+	if s.MaxPayloadSize == 0 {
+		return common.DefaultMaxPayloadSize
+	}
+	return s.MaxPayloadSize
+}
+
+// SendHeartbeat 定期向 srp-client 的每条控制连接发送心跳以测量往返时延，连接断开后返回
+func (s *Server) SendHeartbeat(client *ClientSession) {
+	for {
+		time.Sleep(common.HeartbeatInterval)
+		for _, l := range client.Links() {
+			if err := s.sendDataToLink(client, l, common.NewHeartbeat()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ListenUserTCP 监听 TCP 地址 addr，成功后替换并关闭隧道原来的监听
+func (s *Server) ListenUserTCP(t *Tunnel, addr string) error {
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatal("无法监听tcp连接，" + err.Error())
+		return err
 	}
+	t.listenMu.Lock()
+	old := t.listener
+	t.listener = ln
+	t.listenMu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// AcceptUserConnTCP 接受 TCP 连接，监听被替换后改为在新的监听上接受，隧道的监听关闭后返回
+func (s *Server) AcceptUserConnTCP(t *Tunnel) {
+	ln := t.userListener()
 	for {
-		conn, err := listener.Accept()
+		conn, err := ln.Accept()
 		if err != nil {
-			logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝user：%s的连接，%s", conn.RemoteAddr(), err))
+			if errors.Is(err, net.ErrClosed) {
+				if next := t.userListener(); next != ln {
+					ln = next
+					continue
+				}
+				return
+			}
+			logger.Warn("无法接受user的连接", "tunnel", t.Name, "err", err)
+			continue
+		}
+		if !s.AdmitUserConn(t, conn.RemoteAddr()) {
+			conn.Close()
 			continue
 		}
-		go s.HandleNewConn(conn)
+		go t.HandleNewConn(t, conn)
 	}
 }
 
-// AcceptUserConnUDP 监听和接受 UDP 连接
-func (s *Server) AcceptUserConnUDP() {
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", s.UserIP, s.UserPort))
+// ListenUserUDP 监听 UDP 地址 addr，成功后替换并关闭隧道原来的监听
+func (s *Server) ListenUserUDP(t *Tunnel, addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
-		log.Fatal("无法解析udp地址：" + addr.String() + "，" + err.Error())
+		return i18n.Errorf("无法解析udp地址：%s，%w", addr, err)
 	}
-	conn, err := net.ListenUDP("udp", addr)
+	conn, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
-		log.Fatal("无法监听udp地址：" + addr.String() + "，" + err.Error())
+		return err
 	}
-	defer conn.Close()
+	t.listenMu.Lock()
+	old := t.packetConn
+	t.packetConn = conn
+	t.listenMu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// AcceptUserConnUDP 接受 UDP 连接，监听被替换后改为在新的监听上接受，隧道的监听关闭后返回，
+// 经由原来的监听建立的 UDP 连接无法再发送数据，会在超时后关闭
+func (s *Server) AcceptUserConnUDP(t *Tunnel) {
+	conn := t.userPacketConn()
 
 	// 初始化
 	buffer := make([]byte, common.MaxBufferSize)
@@ -235,26 +803,49 @@ func (s *Server) AcceptUserConnUDP() {
 	for {
 		n, clientAddr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
-			logger.LogWithLevel(s.LogLevel, 2, "读取udp数据失败："+err.Error())
+			if errors.Is(err, net.ErrClosed) {
+				if next := t.userPacketConn(); next != conn {
+					conn = next
+					udpConn = &wrappers.UDPConn{
+						AddrConnMap: make(map[string]*wrappers.UDPWrapper),
+						RWMu:        s.RWMu,
+					}
+					continue
+				}
+				return
+			}
+			logger.Warn("读取udp数据失败", "tunnel", t.Name, "err", err)
 			continue
 		}
 		// 拷贝数据，避免被下一次循环覆盖
 		data := make([]byte, n)
 		copy(data, buffer[:n])
 		// 查看该远程地址是否已经建立映射
+		// 该连接的缓冲已满（如被限速）时丢弃数据，避免阻塞其它连接
 		if c := udpConn.GetConn(clientAddr); c != nil {
-			c.ReadC <- data
+			select {
+			case c.ReadC <- data:
+			default:
+				logger.Trace("丢弃user的udp数据，缓冲已满", "tunnel", t.Name, "remote_addr", clientAddr.String(), "bytes", n)
+			}
 			continue
 		}
-		go s.HandleUserConnUDP(udpConn, conn, clientAddr, data)
+		if !s.AdmitUserConn(t, clientAddr) {
+			continue
+		}
+		go t.HandleNewConn(t, udpConn, conn, clientAddr, data)
 	}
 }
 
 // HandleUserConnTCP 完成 TCP 连接创建和接收数据
 func (s *Server) HandleUserConnTCP(values ...interface{}) {
-	conn, _ := values[0].(net.Conn)
-	if s.ClientConn == nil {
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝user：%s的连接，serp-client未连接", conn.RemoteAddr()))
+	t, _ := values[0].(*Tunnel)
+	conn, _ := values[1].(net.Conn)
+	defer s.ReleaseUserConn(t, conn.RemoteAddr())
+	client := s.PickClient(t, conn.RemoteAddr())
+	if client == nil {
+		logger.Warn("拒绝user的连接，隧道没有可用的srp-client或服务不健康", "tunnel", t.Name, "remote_addr", conn.RemoteAddr().String())
+		s.AddEvent(EventConnRejected, t.Name, "", 0, i18n.Sprintf("%s：没有可用的srp-client", conn.RemoteAddr()))
 		conn.Close()
 		return
 	}
@@ -263,56 +854,172 @@ func (s *Server) HandleUserConnTCP(values ...interface{}) {
 	cid := s.GetNextCID()
 	tcpWrapper := &wrappers.TCPWrapper{
 		Conn:           conn,
-		HandshakeRespC: make(chan common.Proto),
+		HandshakeRespC: make(chan common.Proto, 1),
+		DirectC:        make(chan wrappers.DirectConn, 1),
 	}
-	s.AddUserConn(cid, tcpWrapper)
+	info := s.AddUserConn(cid, tcpWrapper, client)
 	defer s.CloseUserConn(cid)
+	defer info.Capture.Close()
+	log := client.Log.With("cid", cid, "remote_addr", conn.RemoteAddr().String())
 
-	err := s.SendDataToClient(common.NewProto(common.CodeSuccess, common.TypeNewConn, cid, nil))
-	if err != nil {
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝user：%s的连接，无法向srp-client发送数据，%s", conn.RemoteAddr(), err))
+	// srp-client 有空闲的预建数据连接时交给该连接，不经由控制连接申请，预建数据连接均不可用时再经由控制连接申请
+	direct, accepted := s.takePooledConn(info, log)
+	if !accepted {
+		return
+	}
+	if direct != nil {
+		info.endHandshake()
+		log.Debug("已将user的连接交给预建数据连接")
+	} else if direct, accepted = s.requestConn(info, tcpWrapper, log); !accepted {
+		return
+	}
+
+	(conn.(*net.TCPConn)).SetKeepAlive(true)
+	log.Debug("建立连接", "local_addr", conn.LocalAddr().String(), "direct", direct != nil)
+	s.AddEvent(EventConnOpened, t.Name, client.Name, cid, conn.RemoteAddr().String())
+	defer s.LogAccess(info)
+
+	if direct != nil {
+		s.spliceDirect(info, conn, *direct, log)
 		return
 	}
-	logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("已向srp-client发送user(%s)的连接申请", conn.RemoteAddr()))
+
+	connBucket := t.Policy().ConnRate.NewBucket()
+	// 读取消息，由该 goroutine 发送到 srp-client，某个 srp-client 阻塞时不影响其他 srp-client 的连接
+	for {
+		// 直接读取到缓冲池中的有效载荷，发送到 srp-client 后归还
+		data := common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, nil)
+		n, err := data.ReadPayload(conn)
+		if err != nil {
+			log.Debug("与user的连接断开", "err", err)
+			s.AddEvent(EventConnClosed, t.Name, client.Name, cid, i18n.Sprintf("%s：%s", conn.RemoteAddr(), err))
+			info.SetCloseReason(i18n.Sprintf("user：%s", err))
+			s.forwardToClient(client, common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error())))
+			return
+		}
+		info.Stats.AddUp(n)
+		info.Capture.Send(data.Payload)
+		client.Stats.AddUp(n)
+		t.Stats.AddUp(n)
+		// 按用户连接、srp-client 和隧道的上行限速等待
+		ratelimit.WaitAll(n, connBucket, client.UpBucket, t.Policy().UpBucket)
+		s.forwardToClient(client, data)
+	}
+}
+
+// requestConn 经由控制连接向 srp-client 发送连接申请并等待响应，srp-client 接受时返回 true，
+// srp-client 为该连接建立直连数据连接时同样视为接受，并返回该连接
+func (s *Server) requestConn(info *UserConnInfo, w *wrappers.TCPWrapper, log *logger.Logger) (*wrappers.DirectConn, bool) {
+	err := s.SendDataToClient(info.Client, common.NewProto(common.CodeSuccess, common.TypeNewConn, info.CID, nil))
+	if err != nil {
+		log.Warn("拒绝user的连接，无法向srp-client发送数据", "err", err)
+		return nil, false
+	}
+	log.Debug("已向srp-client发送user的连接申请")
 
 	// 验证 TypeAcceptConn
-	data := <-tcpWrapper.HandshakeRespC
+	data, direct, ok := s.awaitConnResp(info, w.HandshakeRespC, w.DirectC, log)
+	if !ok || direct != nil {
+		return direct, ok
+	}
 	if data.Code != common.CodeSuccess || data.Type != common.TypeAcceptConn {
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝user：%s的连接，srp-client拒绝连接：%s", conn.RemoteAddr(), data.Payload))
-		return
+		log.Info("拒绝user的连接，srp-client拒绝连接", "err", string(data.Payload))
+		s.AddEvent(EventConnRejected, info.Tunnel.Name, info.Client.Name, info.CID, i18n.Sprintf("%s：srp-client拒绝连接：%s", info.UserAddr, data.Payload))
+		return nil, false
+	}
+	return nil, true
+}
+
+// awaitConnResp 等待 srp-client 经由控制连接的响应或直连数据连接，directC 为 nil 时只等待响应。
+// 用户连接关闭或超过 NewConnTimeout 未收到响应时返回 false
+func (s *Server) awaitConnResp(info *UserConnInfo, respC <-chan common.Proto, directC <-chan wrappers.DirectConn, log *logger.Logger) (common.Proto, *wrappers.DirectConn, bool) {
+	timer := time.NewTimer(common.NewConnTimeout)
+	defer timer.Stop()
+	select {
+	case data := <-respC:
+		return data, nil, true
+	case dc := <-directC:
+		// 之后经由控制连接到达的响应不再交给该连接
+		info.endHandshake()
+		return common.Proto{}, &dc, true
+	case <-info.done:
+		log.Debug("等待srp-client响应时user的连接已关闭")
+		return common.Proto{}, nil, false
+	case <-timer.C:
+		info.endHandshake()
+		log.Info("拒绝user的连接，等待srp-client响应超时")
+		s.AddEvent(EventConnRejected, info.Tunnel.Name, info.Client.Name, info.CID, i18n.Sprintf("%s：等待srp-client响应超时", info.UserAddr))
+		return common.Proto{}, nil, false
 	}
+}
 
-	(conn.(*net.TCPConn)).SetKeepAlive(true)
-	logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("建立连接(cid：%d)：%s->%s", cid, conn.LocalAddr(), conn.RemoteAddr()))
+// spliceDirect 在用户连接和 srp-client 的直连数据连接之间转发原始字节，任一方向断开后关闭两个连接
+func (s *Server) spliceDirect(info *UserConnInfo, conn net.Conn, direct wrappers.DirectConn, log *logger.Logger) {
+	t, client := info.Tunnel, info.Client
+	defer direct.Close()
 
-	buffer := s.BufferPool.Get().([]byte)
-	defer s.BufferPool.Put(buffer)
-	// 读取消息，放到 DataChan2Client
+	// srp-client 到 user，按 srp-client 和隧道的下行限速等待
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, common.MaxBufferSize)
+		for {
+			n, err := direct.Reader.Read(buf)
+			if n > 0 {
+				info.Stats.AddDown(n)
+				info.Capture.Recv(buf[:n])
+				client.Stats.AddDown(n)
+				t.Stats.AddDown(n)
+				ratelimit.WaitAll(n, client.DownBucket, t.Policy().DownBucket)
+				if _, err := conn.Write(buf[:n]); err != nil {
+					info.SetCloseReason(i18n.Sprintf("user：%s", err))
+					return
+				}
+			}
+			if err != nil {
+				info.SetCloseReason(i18n.Sprintf("srp-client：%s", err))
+				return
+			}
+		}
+	}()
+
+	// user 到 srp-client，按用户连接、srp-client 和隧道的上行限速等待
+	connBucket := t.Policy().ConnRate.NewBucket()
+	buf := make([]byte, common.MaxBufferSize)
 	for {
-		n, err := conn.Read(buffer)
+		n, err := conn.Read(buf)
+		if n > 0 {
+			info.Stats.AddUp(n)
+			info.Capture.Send(buf[:n])
+			client.Stats.AddUp(n)
+			t.Stats.AddUp(n)
+			ratelimit.WaitAll(n, connBucket, client.UpBucket, t.Policy().UpBucket)
+			if _, err := direct.Write(buf[:n]); err != nil {
+				info.SetCloseReason(i18n.Sprintf("srp-client：%s", err))
+				return
+			}
+		}
 		if err != nil {
-			logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("与user：%s的断开连接，%s", conn.RemoteAddr(), err))
-			s.DataChan2Client <- common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error()))
+			log.Debug("与user的连接断开", "err", err)
+			s.AddEvent(EventConnClosed, t.Name, client.Name, info.CID, i18n.Sprintf("%s：%s", conn.RemoteAddr(), err))
+			info.SetCloseReason(i18n.Sprintf("user：%s", err))
 			return
 		}
-		// 打上 CID 标签，只传输读取的所有数据，而不是原来的 buffer
-		// 重新申请内存来拷贝 buffer 也许在某些情况下会造成 GC 性能问题
-		// 但其可以保留现有的代码结构，同时发挥缓冲区复用的优势
-		data := make([]byte, n)
-		copy(data, buffer[:n])
-		s.DataChan2Client <- common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, data)
 	}
 }
 
 // HandleUserConnUDP 完成 UDP 连接创建和接收数据
 func (s *Server) HandleUserConnUDP(values ...interface{}) {
-	udpConn, _ := values[0].(*wrappers.UDPConn)
-	conn, _ := values[1].(*net.UDPConn)
-	clientAddr, _ := values[2].(*net.UDPAddr)
-	data0, _ := values[3].([]byte)
+	t, _ := values[0].(*Tunnel)
+	udpConn, _ := values[1].(*wrappers.UDPConn)
+	conn, _ := values[2].(*net.UDPConn)
+	clientAddr, _ := values[3].(*net.UDPAddr)
+	data0, _ := values[4].([]byte)
+	defer s.ReleaseUserConn(t, clientAddr)
 
-	if s.ClientConn == nil {
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝user：%s的连接，serp-client未连接", conn.RemoteAddr()))
+	client := s.PickClient(t, clientAddr)
+	if client == nil {
+		logger.Warn("拒绝user的连接，隧道没有可用的srp-client或服务不健康", "tunnel", t.Name, "remote_addr", clientAddr.String())
+		s.AddEvent(EventConnRejected, t.Name, "", 0, i18n.Sprintf("%s：没有可用的srp-client", clientAddr))
 		return
 	}
 
@@ -322,44 +1029,58 @@ func (s *Server) HandleUserConnUDP(values ...interface{}) {
 		ClientAddr:     clientAddr,
 		ReadC:          make(chan []byte, 100),
 		Sigc:           make(chan struct{}),
-		HandshakeRespC: make(chan common.Proto),
+		HandshakeRespC: make(chan common.Proto, 1),
 	}
 	cid := s.GetNextCID()
-	err := s.SendDataToClient(common.NewProto(common.CodeSuccess, common.TypeNewConn, cid, nil))
-	if err != nil {
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("拒绝user：%s的连接，无法向srp-client发送数据，%s", clientAddr, err))
-		return
-	}
 
-	// 记录映射
+	// 记录映射，需在发送连接申请前完成，避免 srp-client 的响应找不到对应的连接
 	udpConn.AddConn(clientAddr, udpWrapper)
 	defer udpConn.DelConn(clientAddr)
-	s.AddUserConn(cid, udpWrapper)
+	info := s.AddUserConn(cid, udpWrapper, client)
 	defer s.CloseUserConn(cid)
+	defer info.Capture.Close()
+	log := client.Log.With("cid", cid, "remote_addr", clientAddr.String())
+
+	err := s.SendDataToClient(client, common.NewProto(common.CodeSuccess, common.TypeNewConn, cid, nil))
+	if err != nil {
+		log.Warn("拒绝user的连接，无法向srp-client发送数据", "err", err)
+		return
+	}
 
 	// 写入第一次传输的数据，验证 TypeAcceptConn
 	udpWrapper.ReadC <- data0
-	data := <-udpWrapper.HandshakeRespC
-	if data.Type == common.TypeDisconnect {
-		logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("无法建立UDP连接，srp-server：%s", data.Payload))
+	data, _, ok := s.awaitConnResp(info, udpWrapper.HandshakeRespC, nil, log)
+	if !ok {
+		return
+	}
+	if data.Type != common.TypeAcceptConn {
+		log.Info("无法建立UDP连接，srp-client拒绝连接", "err", string(data.Payload))
+		s.AddEvent(EventConnRejected, t.Name, client.Name, cid, i18n.Sprintf("%s：srp-client拒绝连接：%s", clientAddr, data.Payload))
 		return
 	}
 
 	// 设置 deadline
 	udpWrapper.SetDeadline(time.Now().Add(common.UDPTimeOut))
-	logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("建立连接(cid：%d)：%s->srp-server", cid, clientAddr))
+	log.Debug("建立连接")
+	s.AddEvent(EventConnOpened, t.Name, client.Name, cid, clientAddr.String())
+	defer s.LogAccess(info)
 
-	buffer := s.BufferPool.Get().([]byte)
-	defer s.BufferPool.Put(buffer)
+	connBucket := t.Policy().ConnRate.NewBucket()
 	for {
-		n, err := udpWrapper.Read(buffer)
+		data := common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, nil)
+		n, err := data.ReadPayload(udpWrapper)
 		if err != nil {
-			logger.LogWithLevel(s.LogLevel, 2, fmt.Sprintf("与user：%s的断开连接，%s", clientAddr, err))
-			s.DataChan2Client <- common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error()))
+			log.Debug("与user的连接断开", "err", err)
+			s.AddEvent(EventConnClosed, t.Name, client.Name, cid, i18n.Sprintf("%s：%s", clientAddr, err))
+			info.SetCloseReason(i18n.Sprintf("user：%s", err))
+			s.forwardToClient(client, common.NewProto(common.CodeSuccess, common.TypeDisconnect, cid, []byte(err.Error())))
 			return
 		}
-		data := make([]byte, n)
-		copy(data, buffer[:n])
-		s.DataChan2Client <- common.NewProto(common.CodeSuccess, common.TypeForwarding, cid, data)
+		info.Stats.AddUp(n)
+		info.Capture.Send(data.Payload)
+		client.Stats.AddUp(n)
+		t.Stats.AddUp(n)
+		ratelimit.WaitAll(n, connBucket, client.UpBucket, t.Policy().UpBucket)
+		s.forwardToClient(client, data)
 	}
 }
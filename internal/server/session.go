@@ -0,0 +1,272 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"srp/internal/common"
+	"srp/internal/record"
+	"srp/internal/server/wrappers"
+	"srp/pkg/i18n"
+	"srp/pkg/logger"
+	"srp/pkg/pcapng"
+	"srp/pkg/ratelimit"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientSession 为一个通过验证的 srp-client 连接，
+// 同一隧道可以注册多个 srp-client，由隧道的负载均衡策略分配用户连接
+type ClientSession struct {
+	ID     uint32
+	Name   string // srp-client 名称，在同一隧道中唯一
+	Tunnel *Tunnel
+	*Link                 // 完成握手的第一条控制连接
+	Log    *logger.Logger // 携带 tunnel、client 和 client_addr 字段
+
+	Session string                 // srp-client 生成的会话标识，其余控制连接以其加入会话
+	links   []atomic.Pointer[Link] // 会话的所有控制连接，第一条为 Link，其余在加入前为 nil
+
+	ServiceAddr string // srp-client 报告的被转发服务地址，旧版本 srp-client 不报告
+
+	Version int               // 与 srp-client 协商的协议版本
+	Caps    common.Capability // 与 srp-client 都支持的功能
+
+	MaxPayload  uint32 // srp-client 能够接收的有效载荷最大长度，旧版本 srp-client 不声明，为 0
+	Compression string // 双方发送 TypeForwarding 时使用的压缩算法，为空时不压缩
+	Encrypted   bool   // 控制连接是否加密
+
+	ConnectedAt time.Time
+
+	// 该 srp-client 的上行和下行限速
+	UpBucket   *ratelimit.Bucket
+	DownBucket *ratelimit.Bucket
+
+	Stats common.TrafficStats
+
+	activeConns int64 // 当前承载的用户连接数
+	unhealthy   int32 // srp-client 报告其服务不健康时为 1
+	rtt         int64 // 最近一次心跳测得的控制连接往返时延，单位纳秒
+
+	recorder atomic.Pointer[record.Writer] // 会话的录制，未启用录制时为 nil
+
+	poolMu     sync.Mutex
+	pool       []*idleConn // 空闲的预建数据连接
+	poolClosed bool        // 会话断开后不再接收预建数据连接
+}
+
+// idleConn 为空闲的预建数据连接，空闲期间由 probeIdle 读取，srp-client 不会在分配前发送数据，
+// 读取返回即说明连接已断开
+type idleConn struct {
+	wrappers.DirectConn
+	probed chan struct{} // probeIdle 退出时关闭
+	err    error         // probeIdle 读取返回的错误，probed 关闭后可读
+}
+
+// Key 实现 balancer.Node
+func (c *ClientSession) Key() string {
+	return c.Name
+}
+
+// Active 实现 balancer.Node
+func (c *ClientSession) Active() int64 {
+	return atomic.LoadInt64(&c.activeConns)
+}
+
+// Healthy 返回 srp-client 最近报告的服务健康状态，未进行健康检查的 srp-client 总是健康的
+func (c *ClientSession) Healthy() bool {
+	return atomic.LoadInt32(&c.unhealthy) == 0
+}
+
+// SetHealthy 记录 srp-client 报告的服务健康状态
+func (c *ClientSession) SetHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&c.unhealthy, 0)
+	} else {
+		atomic.StoreInt32(&c.unhealthy, 1)
+	}
+}
+
+// RTT 返回最近一次心跳测得的控制连接往返时延
+func (c *ClientSession) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt))
+}
+
+// SetRTT 记录心跳测得的控制连接往返时延
+func (c *ClientSession) SetRTT(rtt time.Duration) {
+	atomic.StoreInt64(&c.rtt, int64(rtt))
+}
+
+// LinkFor 返回承载 cid 的控制连接，会话只有一条控制连接时总是返回 Link
+func (c *ClientSession) LinkFor(cid uint32) *Link {
+	if l := c.links[common.LinkIndex(cid, len(c.links))].Load(); l != nil {
+		return l
+	}
+	return c.Link
+}
+
+// Links 返回会话已建立的控制连接
+func (c *ClientSession) Links() []*Link {
+	links := make([]*Link, 0, len(c.links))
+	for i := range c.links {
+		if l := c.links[i].Load(); l != nil {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+// Ready 返回会话的控制连接是否都已建立，之前不为其分配用户连接，避免 cid 所属的连接还不存在
+func (c *ClientSession) Ready() bool {
+	return len(c.Links()) == len(c.links)
+}
+
+// join 将第 i 条控制连接加入会话
+func (c *ClientSession) join(i int, l *Link) error {
+	if i <= 0 || i >= len(c.links) {
+		return i18n.Errorf("无效的控制连接序号%d，会话的控制连接数为%d", i, len(c.links))
+	}
+	if !c.links[i].CompareAndSwap(nil, l) {
+		return i18n.Errorf("第%d条控制连接已存在", i)
+	}
+	return nil
+}
+
+// Pooled 返回空闲的预建数据连接数
+func (c *ClientSession) Pooled() int {
+	c.poolMu.Lock()
+	defer c.poolMu.Unlock()
+	return len(c.pool)
+}
+
+// putPooled 将预建数据连接放入会话的空闲连接并开始检测其是否断开，会话已断开或空闲连接已满时返回 false
+func (c *ClientSession) putPooled(dc wrappers.DirectConn) bool {
+	c.poolMu.Lock()
+	defer c.poolMu.Unlock()
+	if c.poolClosed || len(c.pool) >= common.MaxPoolSize {
+		return false
+	}
+	ic := &idleConn{DirectConn: dc, probed: make(chan struct{})}
+	c.pool = append(c.pool, ic)
+	go c.probeIdle(ic)
+	return true
+}
+
+// probeIdle 读取空闲的预建数据连接，连接断开时将其移出空闲连接并关闭；
+// 被取出时由 takePooled 设置读取期限使其返回，已读入缓冲区的数据保留在 Reader 中
+func (c *ClientSession) probeIdle(ic *idleConn) {
+	_, ic.err = ic.Reader.Peek(1)
+	close(ic.probed)
+
+	c.poolMu.Lock()
+	defer c.poolMu.Unlock()
+	if i := slices.Index(c.pool, ic); i >= 0 {
+		c.pool = slices.Delete(c.pool, i, i+1)
+		ic.Close()
+		c.Log.Debug("空闲的预建数据连接断开", "err", ic.err)
+	}
+}
+
+// takePooled 取出最近放入的仍然可用的空闲预建数据连接，已断开的连接被关闭，没有时返回 false
+func (c *ClientSession) takePooled() (wrappers.DirectConn, bool) {
+	for {
+		c.poolMu.Lock()
+		if len(c.pool) == 0 {
+			c.poolMu.Unlock()
+			return wrappers.DirectConn{}, false
+		}
+		ic := c.pool[len(c.pool)-1]
+		c.pool = c.pool[:len(c.pool)-1]
+		c.poolMu.Unlock()
+
+		// 停止检测，只有因读取期限返回的连接仍然可用
+		ic.SetReadDeadline(time.Now())
+		<-ic.probed
+		if !errors.Is(ic.err, os.ErrDeadlineExceeded) || ic.SetReadDeadline(time.Time{}) != nil {
+			c.Log.Debug("空闲的预建数据连接断开", "err", ic.err)
+			ic.Close()
+			continue
+		}
+		return ic.DirectConn, true
+	}
+}
+
+// closePool 关闭所有空闲的预建数据连接，之后放入的连接被拒绝
+func (c *ClientSession) closePool() {
+	c.poolMu.Lock()
+	defer c.poolMu.Unlock()
+	c.poolClosed = true
+	for _, dc := range c.pool {
+		dc.Close()
+	}
+	c.pool = nil
+}
+
+func (c *ClientSession) String() string {
+	return fmt.Sprintf("%s(%s)", c.Name, c.Conn.RemoteAddr())
+}
+
+// pongPayload 返回验证成功时的 TypePong 有效载荷，maxPayload 为 srp-server 能够接收的有效载荷最大长度
+func (c *ClientSession) pongPayload(maxPayload uint32) []byte {
+	payload, _ := common.EncodePongPayload(common.PongPayload{
+		Message:   i18n.T("连接成功"),
+		ConnLimit: c.Tunnel.Policy().ConnRate,
+
+		Version:      c.Version,
+		Capabilities: c.Caps,
+		MaxPayload:   maxPayload,
+		Compression:  c.Compression,
+		Conns:        len(c.links),
+	})
+	return payload
+}
+
+// Link 为 srp-client 的一条控制连接
+type Link struct {
+	Conn   net.Conn
+	Writer *common.FrameWriter // 串行写入 Conn，所有经由该连接发往 srp-client 的帧都由 Writer 发送
+}
+
+// UserConnInfo 为用户连接的信息
+type UserConnInfo struct {
+	CID       uint32
+	Tunnel    *Tunnel
+	Client    *ClientSession // 承载该连接的 srp-client
+	UserAddr  net.Addr
+	CreatedAt time.Time
+	Stats     common.TrafficStats
+	Capture   *pcapng.Flow // 转发数据的抓包，未启用抓包时为 nil
+
+	down        *downQueue    // srp-client 经由控制连接发往该连接的数据
+	done        chan struct{} // 连接关闭时关闭
+	handshaking atomic.Bool   // 正在等待 srp-client 响应连接申请
+
+	reasonMu    sync.Mutex
+	closeReason string // 连接关闭的原因，只保留最先记录的原因
+}
+
+// SetCloseReason 记录连接关闭的原因，已有原因时忽略，
+// 使连接因一端关闭而导致另一端读取失败时保留真正的原因
+func (c *UserConnInfo) SetCloseReason(reason string) {
+	c.reasonMu.Lock()
+	defer c.reasonMu.Unlock()
+	if c.closeReason == "" {
+		c.closeReason = reason
+	}
+}
+
+// endHandshake 结束等待 srp-client 的响应，只有第一次调用返回 true，
+// 保证每个连接最多向握手 chan 发送一次响应
+func (c *UserConnInfo) endHandshake() bool {
+	return c.handshaking.CompareAndSwap(true, false)
+}
+
+// CloseReason 返回连接关闭的原因
+func (c *UserConnInfo) CloseReason() string {
+	c.reasonMu.Lock()
+	defer c.reasonMu.Unlock()
+	return c.closeReason
+}
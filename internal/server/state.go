@@ -0,0 +1,209 @@
+package server
+
+import (
+	"sort"
+	"srp/pkg/i18n"
+	"sync/atomic"
+	"time"
+)
+
+// ClientView 为 srp-client 的状态快照
+type ClientView struct {
+	ID          uint32    `json:"id"`
+	Name        string    `json:"name"`
+	Tunnel      string    `json:"tunnel"`
+	Addr        string    `json:"addr"`
+	Healthy     bool      `json:"healthy"`
+	ActiveConns int64     `json:"active_conns"`
+	RTTMillis   float64   `json:"rtt_ms"`
+	Version     int       `json:"version"`
+	Caps        string    `json:"capabilities"`
+	Encrypted   bool      `json:"encrypted"`
+	Links       int       `json:"links"`
+	Pooled      int       `json:"pooled"`
+	BytesUp     uint64    `json:"bytes_up"`
+	BytesDown   uint64    `json:"bytes_down"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// TunnelView 为隧道的状态快照
+type TunnelView struct {
+	Name          string   `json:"name"`
+	Addr          string   `json:"addr"`
+	Protocol      string   `json:"protocol"`
+	Balance       string   `json:"balance"`
+	Compression   string   `json:"compression"`
+	Enabled       bool     `json:"enabled"`
+	Clients       []string `json:"clients"`
+	ActiveConns   int      `json:"active_conns"`
+	AcceptedConns uint64   `json:"accepted_conns"`
+	RejectedConns uint64   `json:"rejected_conns"`
+	BytesUp       uint64   `json:"bytes_up"`
+	BytesDown     uint64   `json:"bytes_down"`
+	FramesIn      uint64   `json:"frames_in"`
+	FramesOut     uint64   `json:"frames_out"`
+}
+
+// ConnView 为用户连接的状态快照
+type ConnView struct {
+	CID        uint32    `json:"cid"`
+	Tunnel     string    `json:"tunnel"`
+	Client     string    `json:"client"`
+	UserAddr   string    `json:"user_addr"`
+	Protocol   string    `json:"protocol"`
+	BytesUp    uint64    `json:"bytes_up"`
+	BytesDown  uint64    `json:"bytes_down"`
+	CreatedAt  time.Time `json:"created_at"`
+	AgeSeconds float64   `json:"age_seconds"`
+}
+
+// ListClients 返回所有已连接的 srp-client，按隧道名称和 ID 排序
+func (s *Server) ListClients() []ClientView {
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	views := []ClientView{}
+	for _, t := range s.SortedTunnels() {
+		for _, c := range t.Clients {
+			st := c.Stats.Snapshot()
+			views = append(views, ClientView{
+				ID:          c.ID,
+				Name:        c.Name,
+				Tunnel:      t.Name,
+				Addr:        c.Conn.RemoteAddr().String(),
+				Healthy:     c.Healthy(),
+				ActiveConns: c.Active(),
+				RTTMillis:   float64(c.RTT().Microseconds()) / 1000,
+				Version:     c.Version,
+				Caps:        c.Caps.String(),
+				Encrypted:   c.Encrypted,
+				Links:       len(c.Links()),
+				Pooled:      c.Pooled(),
+				BytesUp:     st.BytesUp,
+				BytesDown:   st.BytesDown,
+				ConnectedAt: c.ConnectedAt,
+			})
+		}
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Tunnel != views[j].Tunnel {
+			return views[i].Tunnel < views[j].Tunnel
+		}
+		return views[i].ID < views[j].ID
+	})
+	return views
+}
+
+// ListTunnels 返回所有隧道，按名称排序
+func (s *Server) ListTunnels() []TunnelView {
+	active, _ := s.countUserConns()
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	views := []TunnelView{}
+	for _, t := range s.SortedTunnels() {
+		views = append(views, tunnelView(t, active[t.Name]))
+	}
+	return views
+}
+
+// GetTunnelView 返回隧道的状态快照
+func (s *Server) GetTunnelView(name string) (TunnelView, error) {
+	t := s.GetTunnel(name)
+	if t == nil {
+		return TunnelView{}, i18n.Errorf("隧道不存在：%s", name)
+	}
+	active, _ := s.countUserConns()
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	return tunnelView(t, active[t.Name]), nil
+}
+
+// tunnelView 调用者需持有读锁
+func tunnelView(t *Tunnel, active int) TunnelView {
+	clients := []string{}
+	for _, c := range t.Clients {
+		clients = append(clients, c.Name)
+	}
+	st := t.Stats.Snapshot()
+	p := t.Policy()
+	return TunnelView{
+		Name:          t.Name,
+		Addr:          p.Addr(),
+		Protocol:      t.ServiceProtocol,
+		Balance:       p.Balance,
+		Compression:   p.Compression,
+		Enabled:       t.Enabled(),
+		Clients:       clients,
+		ActiveConns:   active,
+		AcceptedConns: atomic.LoadUint64(&t.AcceptedConns),
+		RejectedConns: atomic.LoadUint64(&t.RejectedConns),
+		BytesUp:       st.BytesUp,
+		BytesDown:     st.BytesDown,
+		FramesIn:      st.FramesIn,
+		FramesOut:     st.FramesOut,
+	}
+}
+
+// ListUserConns 返回所有用户连接，tunnel 不为空时只返回该隧道的连接，按 cid 排序
+func (s *Server) ListUserConns(tunnel string) []ConnView {
+	s.RWMu.RLock()
+	defer s.RWMu.RUnlock()
+	now := time.Now()
+	views := []ConnView{}
+	for _, info := range s.UserConnInfoMap {
+		if tunnel != "" && info.Tunnel.Name != tunnel {
+			continue
+		}
+		st := info.Stats.Snapshot()
+		views = append(views, ConnView{
+			CID:        info.CID,
+			Tunnel:     info.Tunnel.Name,
+			Client:     info.Client.Name,
+			UserAddr:   info.UserAddr.String(),
+			Protocol:   info.Tunnel.ServiceProtocol,
+			BytesUp:    st.BytesUp,
+			BytesDown:  st.BytesDown,
+			CreatedAt:  info.CreatedAt,
+			AgeSeconds: now.Sub(info.CreatedAt).Seconds(),
+		})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].CID < views[j].CID })
+	return views
+}
+
+// KickUserConn 断开用户连接，srp-client 会收到 TypeDisconnect 并关闭对应的服务连接
+func (s *Server) KickUserConn(cid uint32) error {
+	if s.GetUserConn(cid) == nil {
+		return i18n.Errorf("用户连接不存在：%d", cid)
+	}
+	s.CloseUserConnWithReason(cid, i18n.T("被管理接口断开"))
+	return nil
+}
+
+// DisconnectClient 断开 srp-client 的连接及其承载的所有用户连接
+func (s *Server) DisconnectClient(id uint32) error {
+	s.RWMu.RLock()
+	var client *ClientSession
+	for _, t := range s.SortedTunnels() {
+		for _, c := range t.Clients {
+			if c.ID == id {
+				client = c
+			}
+		}
+	}
+	s.RWMu.RUnlock()
+	if client == nil {
+		return i18n.Errorf("srp-client不存在：%d", id)
+	}
+	s.CloseClientConn(client)
+	return nil
+}
+
+// SetTunnelEnabled 启用或停用隧道
+func (s *Server) SetTunnelEnabled(name string, enabled bool) error {
+	t := s.GetTunnel(name)
+	if t == nil {
+		return i18n.Errorf("隧道不存在：%s", name)
+	}
+	t.SetEnabled(enabled)
+	return nil
+}
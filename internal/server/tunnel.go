@@ -0,0 +1,381 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+	"srp/internal/common"
+	"srp/internal/server/acl"
+	"srp/internal/server/balancer"
+	"srp/pkg/i18n"
+	"srp/pkg/logger"
+	"srp/pkg/ratelimit"
+	"srp/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TunnelConfig 为隧道的配置，每个隧道监听一个用户端口
+type TunnelConfig struct {
+	Name string // 隧道名称，srp-client 通过其注册到隧道
+
+	UserIP   string // user ip
+	UserPort int    // user port
+
+	ServiceProtocol string // 和用户通信的协议
+	Balance         string // 多个 srp-client 之间的负载均衡策略
+
+	Allow []string // 允许连接的用户 IP 或 CIDR，为空时允许所有地址
+	Deny  []string // 拒绝连接的用户 IP 或 CIDR
+
+	Rate       ratelimit.Limit // 整个隧道的限速
+	ClientRate ratelimit.Limit // 每个 srp-client 的限速
+	ConnRate   ratelimit.Limit // 每个用户连接的限速
+
+	MaxConns      int             // 最大并发用户连接数，0 表示不限制
+	MaxConnsPerIP int             // 每个用户 IP 的最大并发连接数，0 表示不限制
+	AcceptRate    ratelimit.Limit // 每秒接受的新连接数
+
+	Compression string // 与 srp-client 之间 TypeForwarding 有效载荷的压缩算法，为空或 none 时不压缩
+}
+
+// Tunnel 为 srp-server 对外提供的隧道
+type Tunnel struct {
+	Name            string // 隧道名称，srp-client 通过其注册到隧道
+	ServiceProtocol string // 和用户通信的协议，重新加载时协议变化的隧道会被重新创建
+
+	policy atomic.Pointer[TunnelPolicy] // 隧道当前的配置，通过 Policy 读取，重新加载时整体替换
+
+	Clients []*ClientSession // 注册到该隧道的 srp-client，由 Server.RWMu 保护
+
+	RejectedConns uint64 // 被拒绝的用户连接数
+	AcceptedConns uint64 // 接受的用户连接数
+	Stats         common.TrafficStats
+
+	disabled int32 // 通过管理接口停用隧道时为 1，停用后拒绝新的用户连接
+
+	// 隧道的监听，由 ListenUser 创建或替换，StopTunnel 时关闭
+	listenMu   sync.Mutex
+	listener   net.Listener
+	packetConn *net.UDPConn
+
+	connMu     sync.Mutex
+	conns      int                // 当前用户连接数
+	connsPerIP map[netip.Addr]int // 每个用户 IP 的当前连接数
+
+	rejects rejectLog // 按来源合并拒绝的日志和事件
+
+	// 处理用户与 srp-server 之间连接的函数
+	// 在运行时动态根据隧道的协议被赋值
+	ListenUser     func(t *Tunnel, addr string) error
+	AcceptUserConn func(t *Tunnel)
+	HandleNewConn  func(values ...interface{})
+}
+
+// TunnelPolicy 为隧道的配置及由其创建的负载均衡器、访问控制和令牌桶，创建后不再修改
+type TunnelPolicy struct {
+	TunnelConfig
+
+	Balancer balancer.Balancer
+	ACL      *acl.ACL
+
+	// 上行为 user 到服务的方向，下行为服务到 user 的方向
+	UpBucket   *ratelimit.Bucket
+	DownBucket *ratelimit.Bucket
+
+	AcceptBucket *ratelimit.Bucket
+}
+
+// newTunnelPolicy 根据配置创建 TunnelPolicy，old 不为 nil 时沿用其中策略或速率未变化的负载均衡器和令牌桶
+func newTunnelPolicy(tc TunnelConfig, old *TunnelPolicy) (*TunnelPolicy, error) {
+	if tc.Compression != "" && !slices.Contains(common.Compressions, tc.Compression) {
+		return nil, i18n.Errorf("不支持的压缩算法：%s", tc.Compression)
+	}
+	a, err := acl.New(tc.Allow, tc.Deny)
+	if err != nil {
+		return nil, err
+	}
+	p := &TunnelPolicy{TunnelConfig: tc, ACL: a}
+	if old != nil && old.Balance == tc.Balance {
+		p.Balancer = old.Balancer
+	} else if p.Balancer, err = balancer.New(tc.Balance); err != nil {
+		return nil, err
+	}
+	if old != nil && old.Rate == tc.Rate {
+		p.UpBucket, p.DownBucket = old.UpBucket, old.DownBucket
+	} else {
+		p.UpBucket, p.DownBucket = tc.Rate.NewBucket(), tc.Rate.NewBucket()
+	}
+	if old != nil && old.AcceptRate == tc.AcceptRate {
+		p.AcceptBucket = old.AcceptBucket
+	} else {
+		p.AcceptBucket = tc.AcceptRate.NewBucket()
+	}
+	return p, nil
+}
+
+// NewTunnel 根据配置创建隧道，不设置处理连接的函数
+func NewTunnel(tc TunnelConfig) (*Tunnel, error) {
+	if tc.Name == "" {
+		return nil, i18n.Errorf("隧道名称不能为空")
+	}
+	p, err := newTunnelPolicy(tc, nil)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tunnel{
+		Name:            tc.Name,
+		ServiceProtocol: tc.ServiceProtocol,
+		connsPerIP:      make(map[netip.Addr]int),
+	}
+	t.policy.Store(p)
+	return t, nil
+}
+
+// Policy 返回隧道当前的配置，调用者不能修改返回值
+func (t *Tunnel) Policy() *TunnelPolicy {
+	return t.policy.Load()
+}
+
+// ParseTunnelConfig 解析形如 name=web,port=8080,protocol=tcp 的隧道配置，
+// 未指定的字段使用 base 中的值，allow 和 deny 的多个规则以 | 分隔
+func ParseTunnelConfig(spec string, base TunnelConfig) (TunnelConfig, error) {
+	tc := base
+	tc.Name = ""
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return tc, i18n.Errorf("无效的隧道配置项：%s", field)
+		}
+		switch key {
+		case "name":
+			tc.Name = value
+		case "ip":
+			tc.UserIP = value
+		case "port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return tc, i18n.Errorf("无效的端口：%s", value)
+			}
+			tc.UserPort = port
+		case "protocol":
+			tc.ServiceProtocol = value
+		case "balance":
+			tc.Balance = value
+		case "compression":
+			tc.Compression = value
+		case "allow":
+			tc.Allow = strings.Split(value, "|")
+		case "deny":
+			tc.Deny = strings.Split(value, "|")
+		case "max-conns", "max-conns-per-ip":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return tc, i18n.Errorf("无效的连接数限制%s：%s", key, value)
+			}
+			if key == "max-conns" {
+				tc.MaxConns = n
+			} else {
+				tc.MaxConnsPerIP = n
+			}
+		case "rate", "client-rate", "conn-rate", "accept-rate":
+			limit, err := ratelimit.ParseLimit(value)
+			if err != nil {
+				return tc, i18n.Errorf("无效的限速配置%s：%w", key, err)
+			}
+			switch key {
+			case "rate":
+				tc.Rate = limit
+			case "client-rate":
+				tc.ClientRate = limit
+			case "conn-rate":
+				tc.ConnRate = limit
+			case "accept-rate":
+				tc.AcceptRate = limit
+			}
+		default:
+			return tc, i18n.Errorf("未知的隧道配置项：%s", key)
+		}
+	}
+	if tc.Name == "" {
+		return tc, i18n.Errorf("隧道配置缺少name：%s", spec)
+	}
+	return tc, nil
+}
+
+// GetTunnel 返回名称为 name 的隧道，不存在时返回 nil
+func (s *Server) GetTunnel(name string) *Tunnel {
+	s.tunnelsMu.RLock()
+	defer s.tunnelsMu.RUnlock()
+	return s.Tunnels[name]
+}
+
+// SortedTunnels 返回按名称排序的所有隧道
+func (s *Server) SortedTunnels() []*Tunnel {
+	s.tunnelsMu.RLock()
+	tunnels := make([]*Tunnel, 0, len(s.Tunnels))
+	for _, t := range s.Tunnels {
+		tunnels = append(tunnels, t)
+	}
+	s.tunnelsMu.RUnlock()
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].Name < tunnels[j].Name })
+	return tunnels
+}
+
+// Enabled 返回隧道是否接受新的用户连接
+func (t *Tunnel) Enabled() bool {
+	return atomic.LoadInt32(&t.disabled) == 0
+}
+
+// SetEnabled 启用或停用隧道，停用不影响已建立的用户连接
+func (t *Tunnel) SetEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&t.disabled, 0)
+	} else {
+		atomic.StoreInt32(&t.disabled, 1)
+	}
+}
+
+// Addr 返回用户访问该隧道的地址
+func (t *Tunnel) Addr() string {
+	return t.Policy().Addr()
+}
+
+// Addr 返回配置中用户访问隧道的地址
+func (tc TunnelConfig) Addr() string {
+	return net.JoinHostPort(tc.UserIP, strconv.Itoa(tc.UserPort))
+}
+
+// userListener 返回隧道当前的 TCP 监听
+func (t *Tunnel) userListener() net.Listener {
+	t.listenMu.Lock()
+	defer t.listenMu.Unlock()
+	return t.listener
+}
+
+// userPacketConn 返回隧道当前的 UDP 监听
+func (t *Tunnel) userPacketConn() *net.UDPConn {
+	t.listenMu.Lock()
+	defer t.listenMu.Unlock()
+	return t.packetConn
+}
+
+// closeListener 关闭隧道的监听
+func (t *Tunnel) closeListener() {
+	t.listenMu.Lock()
+	defer t.listenMu.Unlock()
+	if t.listener != nil {
+		t.listener.Close()
+	}
+	if t.packetConn != nil {
+		t.packetConn.Close()
+	}
+}
+
+// AdmitUserConn 在处理用户连接前检查访问控制规则、新连接速率和并发连接数，
+// 拒绝时记录日志和计数，接受时调用者需在连接关闭后调用 ReleaseUserConn
+func (s *Server) AdmitUserConn(t *Tunnel, addr net.Addr) bool {
+	reason := ""
+	p := t.Policy()
+	if !t.Enabled() {
+		reason = i18n.T("隧道已停用")
+	} else if !p.ACL.Permit(addr) {
+		reason = i18n.T("不满足访问控制规则")
+	} else if !p.AcceptBucket.Allow(1) {
+		reason = i18n.T("超过新连接速率限制")
+	} else {
+		ip, _ := utils.AddrIP(addr)
+		t.connMu.Lock()
+		if p.MaxConns > 0 && t.conns >= p.MaxConns {
+			reason = i18n.T("超过最大连接数")
+		} else if p.MaxConnsPerIP > 0 && t.connsPerIP[ip] >= p.MaxConnsPerIP {
+			reason = i18n.T("超过单个IP的最大连接数")
+		} else {
+			t.conns++
+			t.connsPerIP[ip]++
+		}
+		t.connMu.Unlock()
+	}
+	if reason == "" {
+		atomic.AddUint64(&t.AcceptedConns, 1)
+		return true
+	}
+	n := atomic.AddUint64(&t.RejectedConns, 1)
+	// 同一来源在 rejectLogInterval 内只记录一次，避免被拒绝的来源持续发送数据时刷屏并挤掉其他事件
+	ip, _ := utils.AddrIP(addr)
+	report, suppressed := t.rejects.note(ip, time.Now())
+	if !report {
+		logger.Debug("拒绝user的连接", "tunnel", t.Name, "remote_addr", addr.String(), "reason", reason, "rejected", n)
+		return false
+	}
+	logger.Info("拒绝user的连接", "tunnel", t.Name, "remote_addr", addr.String(), "reason", reason, "rejected", n, "suppressed", suppressed)
+	if suppressed > 0 {
+		s.AddEvent(EventConnRejected, t.Name, "", 0, i18n.Sprintf("%s：%s，此前合并了%d次拒绝", addr, reason, suppressed))
+	} else {
+		s.AddEvent(EventConnRejected, t.Name, "", 0, i18n.Sprintf("%s：%s", addr, reason))
+	}
+	return false
+}
+
+const (
+	// rejectLogInterval 为同一来源的拒绝日志和事件的最小间隔，期间的拒绝只计数，在下一次记录时汇总
+	rejectLogInterval = 10 * time.Second
+	// maxRejectSources 为记录拒绝的来源数上限，超过时清理过期的来源，仍然超过时不再记录新的来源
+	maxRejectSources = 4096
+)
+
+// rejectLog 按来源 IP 合并被拒绝的用户连接的日志和事件
+type rejectLog struct {
+	mu      sync.Mutex
+	sources map[netip.Addr]*rejectSource
+}
+
+type rejectSource struct {
+	reported   time.Time // 最近一次记录的时间
+	suppressed int       // 此后未记录的拒绝次数
+}
+
+// note 记录一次来自 ip 的拒绝，返回本次是否需要记录，以及需要记录时此前被合并的拒绝次数
+func (r *rejectLog) note(ip netip.Addr, now time.Time) (bool, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if src, ok := r.sources[ip]; ok {
+		if now.Sub(src.reported) < rejectLogInterval {
+			src.suppressed++
+			return false, 0
+		}
+		suppressed := src.suppressed
+		src.reported, src.suppressed = now, 0
+		return true, suppressed
+	}
+	if r.sources == nil {
+		r.sources = make(map[netip.Addr]*rejectSource)
+	}
+	if len(r.sources) >= maxRejectSources {
+		for k, src := range r.sources {
+			if now.Sub(src.reported) >= rejectLogInterval {
+				delete(r.sources, k)
+			}
+		}
+		if len(r.sources) >= maxRejectSources {
+			return false, 0
+		}
+	}
+	r.sources[ip] = &rejectSource{reported: now}
+	return true, 0
+}
+
+// ReleaseUserConn 在用户连接关闭后释放其占用的连接数
+func (s *Server) ReleaseUserConn(t *Tunnel, addr net.Addr) {
+	ip, _ := utils.AddrIP(addr)
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+	t.conns--
+	if t.connsPerIP[ip]--; t.connsPerIP[ip] <= 0 {
+		delete(t.connsPerIP, ip)
+	}
+}
@@ -1,6 +1,7 @@
 package wrappers
 
 import (
+	"bufio"
 	"net"
 	"srp/internal/common"
 )
@@ -9,5 +10,12 @@ import (
 type TCPWrapper struct {
 	net.Conn
 
-	HandshakeRespC chan common.Proto // handshake response chan：srp-client 响应的握手信息
+	HandshakeRespC chan common.Proto // handshake response chan：srp-client 响应的握手信息，容量为 1
+	DirectC        chan DirectConn   // srp-client 为该连接建立的直连数据连接，容量为 1
+}
+
+// DirectConn 为 srp-client 为用户连接建立的直连数据连接
+type DirectConn struct {
+	net.Conn
+	Reader *bufio.Reader // 读取 Conn，包含握手时已经读入缓冲区的数据
 }
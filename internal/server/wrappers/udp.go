@@ -19,7 +19,7 @@ type UDPWrapper struct {
 
 	ReadC          chan []byte       // 从该 UDP 连接中读取数据
 	Sigc           chan struct{}     // signal cancel: deadline 取消信号
-	HandshakeRespC chan common.Proto // handshake response chan：srp-client 响应的握手信息
+	HandshakeRespC chan common.Proto // handshake response chan：srp-client 响应的握手信息，容量为 1
 
 	Deadline time.Time
 }
@@ -0,0 +1,418 @@
+package i18n
+
+// en 为英文的消息目录，键为代码中的中文原文
+var en = map[string]string{
+	"srp-server的IP地址":             "IP address of srp-server",
+	"srp-server监听的端口":             "port srp-server listens on",
+	"被转发服务的IP地址":                  "IP address of the forwarded service",
+	"被转发服务的端口":                    "port of the forwarded service",
+	"连接srp-server的密码":             "password for connecting to srp-server",
+	"srp-client和被转发服务的通信协议，支持：%s": "protocol between srp-client and the forwarded service, supported: %s",
+	"注册到srp-server的隧道名称":          "tunnel name to register with srp-server",
+	"srp-client名称，同一隧道的多个srp-client名称不能相同，默认为主机名": "srp-client name, must be unique among srp-clients of the same tunnel, defaults to the hostname",
+	"服务健康检查方式，支持：tcp，http，默认不检查":                  "service health check method, supported: tcp, http, no check by default",
+	"服务健康检查间隔":      "service health check interval",
+	"服务健康检查超时时间":    "service health check timeout",
+	"HTTP健康检查的请求路径": "request path of the HTTP health check",
+	"Prometheus指标接口/metrics的监听地址，如127.0.0.1:9101，默认不启用": "listen address of the Prometheus metrics endpoint /metrics, e.g. 127.0.0.1:9101, disabled by default",
+	"日志级别，支持：%s，兼容旧版本的1-3":                              "log level, supported: %s, the legacy values 1-3 are also accepted",
+	"日志格式，支持：%s":                                        "log format, supported: %s",
+	"日志文件路径，默认输出到标准错误，收到SIGUSR1信号时重新打开":                 "log file path, logs go to standard error by default, the file is reopened on SIGUSR1",
+	"日志文件的最大大小，超过后轮转，支持K、M、G单位，0表示不按大小轮转":               "maximum size of the log file before rotation, supports K, M, G units, 0 disables size based rotation",
+	"日志文件的最长使用时间，超过后轮转，如24h，0表示不按时间轮转":                  "maximum age of the log file before rotation, e.g. 24h, 0 disables age based rotation",
+	"保留的旧日志文件数量，0表示全部保留":                                "number of old log files to keep, 0 keeps all",
+	"以gzip压缩旧日志文件":                                      "compress old log files with gzip",
+	"界面语言，支持：%s，默认根据环境变量LANG选择":                         "interface language, supported: %s, chosen from the LANG environment variable by default",
+	"打印版本信息":                    "print version information",
+	"无效的日志文件大小，":                "invalid log file size, ",
+	"无法打开日志文件，":                 "cannot open log file, ",
+	"不支持的协议":                    "unsupported protocol",
+	"不支持的健康检查方式":                "unsupported health check method",
+	"被转发服务地址":                   "forwarded service address",
+	"srp-server地址":              "srp-server address",
+	"无法提供指标接口":                  "cannot serve metrics endpoint",
+	"指标接口地址":                    "metrics endpoint address",
+	"无法处理srp-server的数据":         "cannot handle data from srp-server",
+	"无匹配的cid":                   "no matching cid",
+	"无法转发数据到服务":                 "cannot forward data to service",
+	"转发数据到服务":                   "forward data to service",
+	"关闭用户连接":                    "close user connection",
+	"srp-client连接的IP地址":         "IP address srp-clients connect to",
+	"srp-client连接的端口":           "port srp-clients connect to",
+	"用户访问被转发服务的IP地址":            "IP address users access the forwarded service on",
+	"用户访问被转发服务的端口":              "port users access the forwarded service on",
+	"srp-server连接密码":            "srp-server connection password",
+	"用户和srp-server间的通信协议，支持：%s": "protocol between users and srp-server, supported: %s",
+	"多个srp-client注册同一隧道时的负载均衡策略，支持：%s":            "load balancing strategy when several srp-clients register the same tunnel, supported: %s",
+	"允许连接的用户IP或CIDR，多个规则以逗号分隔，默认允许所有地址":           "user IPs or CIDRs allowed to connect, comma separated, all addresses are allowed by default",
+	"拒绝连接的用户IP或CIDR，多个规则以逗号分隔，优先于allow":           "user IPs or CIDRs denied from connecting, comma separated, takes precedence over allow",
+	"隧道的限速，格式：速率[:突发容量]，支持K、M、G单位，如10M:20M，默认不限速": "rate limit of the tunnel, format: rate[:burst], supports K, M, G units, e.g. 10M:20M, unlimited by default",
+	"每个srp-client的限速，格式同rate":                     "rate limit of each srp-client, same format as rate",
+	"每个用户连接的限速，格式同rate":                           "rate limit of each user connection, same format as rate",
+	"隧道的最大并发用户连接数，0表示不限制":                         "maximum concurrent user connections of the tunnel, 0 means unlimited",
+	"每个用户IP的最大并发连接数，0表示不限制":                       "maximum concurrent connections per user IP, 0 means unlimited",
+	"每秒接受的新用户连接数，格式：速率[:突发容量]，默认不限制":              "new user connections accepted per second, format: rate[:burst], unlimited by default",
+	"隧道配置，可重复指定，格式：name=web,port=8080[,配置项=值...]\n配置项：ip、protocol、balance、compression、allow、deny、rate、client-rate、conn-rate、max-conns、max-conns-per-ip、accept-rate，\n含义同对应的命令行参数（ip对应server-ip），allow和deny的多个规则以|分隔，未指定的项使用对应命令行参数的值\n未指定该参数时使用名为%s的默认隧道": "tunnel config, may be repeated, format: name=web,port=8080[,option=value...]\noptions: ip, protocol, balance, compression, allow, deny, rate, client-rate, conn-rate, max-conns, max-conns-per-ip, accept-rate,\nwith the same meaning as the matching flags (ip matches server-ip), multiple allow and deny rules are separated by |, unset options use the value of the matching flag\nwhen not given, a default tunnel named %s is used",
+	"隧道配置文件，每行一个格式同tunnel参数的隧道配置，#开头的行为注释，\n可通过管理接口或SIGHUP信号重新加载，不能与tunnel参数同时使用":                                                                                                                                                                         "tunnel file, one tunnel config per line in the same format as the tunnel flag, lines starting with # are comments,\ncan be reloaded through the admin API or SIGHUP, cannot be used together with the tunnel flag",
+	"Prometheus指标接口/metrics的监听地址，如127.0.0.1:9100，默认不启用":  "listen address of the Prometheus metrics endpoint /metrics, e.g. 127.0.0.1:9100, disabled by default",
+	"管理接口的监听地址，如127.0.0.1:9200或unix:/run/srp.sock，默认不启用": "listen address of the admin API, e.g. 127.0.0.1:9200 or unix:/run/srp.sock, disabled by default",
+	"管理接口的访问令牌，监听TCP地址时必须指定":                             "access token of the admin API, required when listening on a TCP address",
+	"网页控制台的监听地址，如0.0.0.0:9300，默认不启用":                     "listen address of the web dashboard, e.g. 0.0.0.0:9300, disabled by default",
+	"网页控制台的登录用户名":                                        "login user name of the web dashboard",
+	"网页控制台的登录密码，启用控制台时必须指定":                              "login password of the web dashboard, required when the dashboard is enabled",
+	"无效的限速配置":                        "invalid rate limit",
+	"tunnel-file不能与tunnel参数同时使用":     "tunnel-file cannot be used together with the tunnel flag",
+	"无法读取隧道配置文件":                     "cannot read tunnel file",
+	"无效的隧道配置":                        "invalid tunnel config",
+	"srp-client连接地址":                 "srp-client connect address",
+	"无法创建隧道":                         "cannot create tunnel",
+	"管理接口监听TCP地址时必须指定admin-token":    "admin-token is required when the admin API listens on a TCP address",
+	"无法监听管理接口":                       "cannot listen on admin API address",
+	"无法提供管理接口":                       "cannot serve admin API",
+	"管理接口地址":                         "admin API address",
+	"启用网页控制台时必须指定dashboard-password": "dashboard-password is required when the web dashboard is enabled",
+	"无法提供网页控制台":                      "cannot serve web dashboard",
+	"网页控制台地址":                        "web dashboard address",
+	"丢弃user发往srp-client的数据包，无法发送数据":  "drop packet from user to srp-client, cannot send data",
+	"转发数据到srp-client":                "forward data to srp-client",
+	"关闭user的连接":                      "close user connection",
+	"丢弃srp-client发往user的数据包，无法发送数据":  "drop packet from srp-client to user, cannot send data",
+	"转发数据到user":                      "forward data to user",
+	"srp-server管理接口的地址，如unix:/run/srp.sock或127.0.0.1:9200，默认读取环境变量SRP_ADMIN_ADDR": "address of the srp-server admin API, e.g. unix:/run/srp.sock or 127.0.0.1:9200, read from the SRP_ADMIN_ADDR environment variable by default",
+	"管理接口的访问令牌，默认读取环境变量SRP_ADMIN_TOKEN":                                           "access token of the admin API, read from the SRP_ADMIN_TOKEN environment variable by default",
+	"以JSON格式输出":     "output as JSON",
+	"srpctl，版本：%s":  "srpctl, version: %s",
+	"conns最多指定一个隧道": "conns accepts at most one tunnel",
+	"stats需要指定一个隧道": "stats requires one tunnel",
+	"%s需要指定至少一个id":  "%s requires at least one id",
+	"%s需要指定一个隧道":    "%s requires one tunnel",
+	"未知的命令：%s":      "unknown command: %s",
+	"srpctl：%s":     "srpctl: %s",
+	"输出最近的事件数量":     "number of recent events to print",
+	"持续输出新事件":       "keep printing new events",
+	"无效的id：%s":      "invalid id: %s",
+	`用法：srpctl [参数] <命令> [命令参数]
+
+命令：
+  status                  隧道和srp-client概览
+  tunnels                 列出隧道
+  clients                 列出已连接的srp-client
+  conns [隧道]            列出用户连接
+  stats <隧道>            隧道的状态和统计
+  events [-n 数量] [-f]   最近的事件，-f持续输出新事件
+  kill <cid>...           断开用户连接
+  disconnect <id>...      断开srp-client
+  enable <隧道>           启用隧道
+  disable <隧道>          停用隧道，拒绝新的用户连接
+  reload                  重新加载srp-server的隧道配置文件
+
+参数：
+`: `Usage: srpctl [flags] <command> [args]
+
+Commands:
+  status                  overview of tunnels and srp-clients
+  tunnels                 list tunnels
+  clients                 list connected srp-clients
+  conns [tunnel]          list user connections
+  stats <tunnel>          status and statistics of a tunnel
+  events [-n count] [-f]  recent events, -f keeps printing new events
+  kill <cid>...           disconnect user connections
+  disconnect <id>...      disconnect srp-clients
+  enable <tunnel>         enable a tunnel
+  disable <tunnel>        disable a tunnel, rejecting new user connections
+  reload                  reload the tunnel file of srp-server
+
+Flags:
+`,
+	"与srp-server建立连接失败":        "failed to connect to srp-server",
+	"已向srp-server发送验证信息，等待响应":  "sent authentication to srp-server, waiting for response",
+	"连接超时，请检查必要信息，在稍后重试":       "connection timed out, check the settings and retry later",
+	"成功与srp-server建立连接":        "connected to srp-server",
+	"未建立和srp-server的连接":        "not connected to srp-server",
+	"无法向srp-server发送心跳":        "cannot send heartbeat to srp-server",
+	"无法响应srp-server的心跳":        "cannot answer heartbeat from srp-server",
+	"srp-server的往返时延":          "round trip time to srp-server",
+	"拒绝用户连接，无法和服务建立连接":         "reject user connection, cannot connect to service",
+	"无法和服务建立连接：%s":             "cannot connect to service: %s",
+	"无法向srp-server发送数据":        "cannot send data to srp-server",
+	"建立连接":                     "connection established",
+	"用户连接的服务连接断开":              "service connection of user connection closed",
+	"无法向服务发起UDP连接":             "cannot open UDP connection to service",
+	"HTTP状态码：%d":               "HTTP status code: %d",
+	"服务健康":                     "service healthy",
+	"服务健康检查失败":                 "service health check failed",
+	"服务健康检查通过":                 "service health check passed",
+	"无法向srp-server发送健康状态":      "cannot send health status to srp-server",
+	"解码Payload失败: %w":          "decode Payload: %w",
+	"管理接口返回%s":                 "admin API returned %s",
+	"无效的IP地址：%s":               "invalid IP address: %s",
+	"无效的CIDR：%s":               "invalid CIDR: %s",
+	"无效的srp-client id：%s":      "invalid srp-client id: %s",
+	"未知的操作：%s":                 "unknown action: %s",
+	"管理接口":                     "admin API",
+	"无效的cid：%s":                "invalid cid: %s",
+	"未授权":                      "unauthorized",
+	"不支持推送事件":                  "event streaming not supported",
+	"不支持的负载均衡策略：%s":            "unsupported load balancing strategy: %s",
+	"未登录":                      "not logged in",
+	"控制台为只读":                   "dashboard is read only",
+	"%s第%d行：%w":                "%s line %d: %w",
+	"%s第%d行：隧道名称重复：%s":         "%s line %d: duplicate tunnel name: %s",
+	"%s中没有隧道配置":                "no tunnel config in %s",
+	"不支持的协议：%s":                "unsupported protocol: %s",
+	"隧道名称重复：%s":                "duplicate tunnel name: %s",
+	"无法监听隧道%s的地址%s，%w":         "cannot listen on address %[2]s of tunnel %[1]s, %[3]w",
+	"隧道开始监听":                   "tunnel listening",
+	"隧道已停止":                    "tunnel stopped",
+	"未指定隧道配置文件":                "no tunnel file specified",
+	"隧道%s：%w":                  "tunnel %s: %w",
+	"%s，%s":                    "%s, %s",
+	"重新加载隧道配置时出错":              "error reloading tunnel config",
+	"重新加载隧道配置":                 "reloaded tunnel config",
+	"隧道%s已被移除":                 "tunnel %s has been removed",
+	"隧道%s中已存在名为%s的srp-client":  "an srp-client named %[2]s already exists in tunnel %[1]s",
+	"无法创建tcp监听":                "cannot create tcp listener",
+	"无法接受srp-client的连接":        "cannot accept srp-client connection",
+	"开始处理srp-client的连接":        "handling srp-client connection",
+	"拒绝srp-client的连接，无法读取验证信息": "reject srp-client connection, cannot read authentication",
+	"连接失败，密码错误":                "connection failed, wrong password",
+	"拒绝srp-client的连接，密码错误":     "reject srp-client connection, wrong password",
+	"连接失败，隧道不存在：%s":            "connection failed, tunnel does not exist: %s",
+	"拒绝srp-client的连接，隧道不存在":    "reject srp-client connection, tunnel does not exist",
+	"连接失败，%s":                  "connection failed, %s",
+	"拒绝srp-client的连接":          "reject srp-client connection",
+	"连接成功":                     "connected",
+	"%s：%s":                    "%s: %s",
+	"拒绝srp-client的连接，无法发送数据":   "reject srp-client connection, cannot send data",
+	"成功建立与srp-client的连接":       "connected to srp-client",
+	"与srp-client的连接断开":         "connection to srp-client closed",
+	"无法响应srp-client的心跳":        "cannot answer heartbeat from srp-client",
+	"srp-client的往返时延":          "round trip time to srp-client",
+	"srp-client的服务健康状态变化":      "service health of srp-client changed",
+	"healthy=%t，%s":            "healthy=%t, %s",
+	"无效的cid":                   "invalid cid",
+	"未知的数据格式":                  "unknown data type",
+	"未建立和srp-client的连接":        "not connected to srp-client",
+	"无法接受user的连接":              "cannot accept user connection",
+	"无法解析udp地址：%s，%w":          "cannot resolve udp address: %s, %w",
+	"读取udp数据失败":                "failed to read udp data",
+	"丢弃user的udp数据，缓冲已满":        "drop udp data from user, buffer full",
+	"拒绝user的连接，隧道没有可用的srp-client或服务不健康": "reject user connection, no srp-client available or service unhealthy",
+	"%s：没有可用的srp-client":                "%s: no srp-client available",
+	"拒绝user的连接，无法向srp-client发送数据":       "reject user connection, cannot send data to srp-client",
+	"已向srp-client发送user的连接申请":           "sent user connection request to srp-client",
+	"拒绝user的连接，srp-client拒绝连接":          "reject user connection, srp-client refused",
+	"%s：srp-client拒绝连接：%s":              "%s: srp-client refused: %s",
+	"与user的连接断开":                        "connection to user closed",
+	"无法建立UDP连接，srp-client拒绝连接":          "cannot open UDP connection, srp-client refused",
+	"隧道不存在：%s":                          "tunnel does not exist: %s",
+	"用户连接不存在：%d":                        "user connection does not exist: %d",
+	"srp-client不存在：%d":                  "srp-client does not exist: %d",
+	"隧道名称不能为空":                          "tunnel name cannot be empty",
+	"无效的隧道配置项：%s":                       "invalid tunnel option: %s",
+	"无效的端口：%s":                          "invalid port: %s",
+	"无效的连接数限制%s：%s":                     "invalid connection limit %s: %s",
+	"无效的限速配置%s：%w":                      "invalid rate limit %s: %w",
+	"未知的隧道配置项：%s":                       "unknown tunnel option: %s",
+	"隧道配置缺少name：%s":                     "tunnel config is missing name: %s",
+	"隧道已停用":                             "tunnel disabled",
+	"不满足访问控制规则":                         "denied by access control rules",
+	"超过新连接速率限制":                         "new connection rate limit exceeded",
+	"超过最大连接数":                           "maximum connections exceeded",
+	"超过单个IP的最大连接数":                      "maximum connections per IP exceeded",
+	"拒绝user的连接":                         "reject user connection",
+	"未知的日志级别：%s，支持：%s":                  "unknown log level: %s, supported: %s",
+	"未知的日志格式：%s，支持：%s":                  "unknown log format: %s, supported: %s",
+	"无法轮转日志文件%s，%s":                     "cannot rotate log file %s, %s",
+	"无法压缩日志文件%s，%s":                     "cannot compress log file %s, %s",
+	"无法列出旧日志文件，%s":                      "cannot list old log files, %s",
+	"无法删除旧日志文件%s，%s":                    "cannot remove old log file %s, %s",
+	"无法重新打开日志文件":                        "cannot reopen log file",
+	"已重新打开日志文件":                         "reopened log file",
+	"不限速":                               "unlimited",
+	"%dbyte/s（突发%dbyte）":                "%dbyte/s (burst %dbyte)",
+	"协议":                                " protocol",
+	"无效的大小：%q":                          "invalid size: %q",
+	"不支持的语言：%s，支持：%s":                   "unsupported language: %s, supported: %s",
+	"用户连接的访问日志文件路径，每个结束的用户连接写入一条记录，-表示输出到标准输出，\n文件的轮转方式同日志文件，默认不记录": "access log file of user connections, one record per finished connection, - writes to standard output,\nthe file is rotated like the log file, disabled by default",
+	"访问日志格式，支持：%s":       "access log format, supported: %s",
+	"无法打开访问日志文件":         "cannot open access log file",
+	"无效的访问日志配置":          "invalid access log config",
+	"srp-client：%s":      "srp-client: %s",
+	"未知的访问日志格式：%s，支持：%s": "unknown access log format: %s, supported: %s",
+	"无法写入访问日志":           "cannot write access log",
+	"srp-client断开连接":     "srp-client disconnected",
+	"user：%s":            "user: %s",
+	"被管理接口断开":            "closed by admin API",
+	"抓包目录，将每个用户连接转发的数据写入该目录下的pcapng文件，可用Wireshark打开，用于调试，默认不启用": "capture directory, the data forwarded by each user connection is written to a pcapng file in it for opening in Wireshark, for debugging, disabled by default",
+	"无法抓包，无效的用户地址": "cannot capture, invalid user address",
+	"无法抓包，无效的服务地址": "cannot capture, invalid service address",
+	"无法创建抓包文件":     "cannot create capture file",
+	"开始抓包":         "capture started",
+	"无法创建抓包目录":     "cannot create capture directory",
+	"录制目录，将每个srp-client会话的协议帧写入该目录下的文件，可用srpreplay重放，用于调试，默认不启用": "recording directory, the protocol frames of each srp-client session are written to a file in it for replaying with srpreplay, for debugging, disabled by default",
+	"无法创建录制目录":                           "cannot create recording directory",
+	"server命令监听的地址":                      "address the server command listens on",
+	"client命令连接的srp-server地址":            "srp-server address the client command connects to",
+	"client命令连接srp-server的密码，录制文件中不包含密码": "password the client command uses for srp-server, recordings do not contain the password",
+	"重放速度的倍数，0表示不等待，尽快发送":                "replay speed multiplier, 0 sends as fast as possible without waiting",
+	"发送完所有帧后等待对端响应的时间":                   "time to wait for the peer after all frames are sent",
+	"输出有效载荷":                             "print payloads",
+	"srpreplay，版本：%s":                    "srpreplay, version: %s",
+	"srpreplay：%s":                       "srpreplay: %s",
+	"等待srp-client连接%s":                   "waiting for srp-client on %s",
+	"第%d帧不一致，录制：%s，收到：%s":                "frame %d differs, recorded: %s, received: %s",
+	"帧数量不一致，录制：%d，收到：%d":                 "frame count differs, recorded: %d, received: %d",
+	"重放完成，%d帧一致":                         "replay finished, %d frames match",
+	`用法：srpreplay [参数] <命令> <录制文件>
+
+命令：
+  dump     输出录制的协议帧
+  server   作为srp-server监听listen地址，srp-client连接后按录制的时间发送srp-server发出的帧，
+           并将srp-client发来的帧与录制的比较
+  client   作为srp-client连接server地址，按录制的时间发送srp-client发出的帧，
+           并将srp-server发来的帧与录制的比较
+
+心跳帧与时间有关，重放时不发送也不比较；重放的帧与录制不一致时以状态码1退出。
+
+参数：
+`: `Usage: srpreplay [flags] <command> <recording>
+
+Commands:
+  dump     print the recorded protocol frames
+  server   act as srp-server on the listen address, once an srp-client connects send the
+           frames srp-server sent at the recorded times and compare the frames srp-client sends
+  client   act as srp-client and connect to the server address, send the frames srp-client sent
+           at the recorded times and compare the frames srp-server sends
+
+Heartbeat frames depend on time and are neither sent nor compared; exits with status 1
+when the replayed frames differ from the recording.
+
+Flags:
+`,
+	"不是srp录制文件":         "not an srp recording",
+	"录制文件不完整":           "recording is truncated",
+	"录制文件不完整：%w":        "recording is truncated: %w",
+	"无法创建录制文件":          "cannot create recording file",
+	"开始录制srp-client的会话": "recording srp-client session",
+	"比较TypeForwarding的有效载荷，服务的响应含有时间等变化的内容时可关闭": "compare TypeForwarding payloads, disable when service responses contain changing content such as timestamps",
+	"srp-server不支持健康状态上报，不进行健康检查":               "srp-server does not support health reporting, health check disabled",
+	"未知功能0x%x": "unknown capability 0x%x",
+	"不兼容的协议版本，对端支持%d-%d，本端支持%d-%d":                           "incompatible protocol version, peer supports %d-%d, local supports %d-%d",
+	"能够接收的协议帧有效载荷的最大长度，超过时断开与srp-server的连接，支持K、M、G单位，最小为%d":  "maximum payload size of received protocol frames, the connection to srp-server is closed when exceeded, supports K, M, G units, minimum %d",
+	"控制连接的读取超时时间，双方都支持心跳时，超过该时间未收到srp-server的数据则断开连接，0表示不超时": "read timeout of the control connection; when both sides support heartbeats, the connection is closed if nothing is received from srp-server within it, 0 means no timeout",
+	"无效的有效载荷最大长度": "invalid maximum payload size",
+	"能够接收的协议帧有效载荷的最大长度，超过时断开srp-client的连接，支持K、M、G单位，最小为%d":   "maximum payload size of received protocol frames, the srp-client connection is closed when exceeded, supports K, M, G units, minimum %d",
+	"控制连接的读取超时时间，双方都支持心跳时，超过该时间未收到srp-client的数据则断开连接，0表示不超时": "read timeout of the control connection; when both sides support heartbeats, the connection is closed if nothing is received from srp-client within it, 0 means no timeout",
+	"未知的状态码%d":             "unknown status code %d",
+	"未知的数据类型%d":            "unknown frame type %d",
+	"有效载荷长度%d超过上限%d":       "payload length %d exceeds the limit %d",
+	"有效载荷长度%d超过对端的上限%d":    "payload length %d exceeds the peer's limit %d",
+	"有效载荷最大长度需在%d到%d之间：%s": "maximum payload size must be between %d and %d: %s",
+	"read-timeout需大于心跳间隔":  "read-timeout must be longer than the heartbeat interval",
+	"解码帧头失败: %w":           "decode header: %w",
+	"控制连接合并写入前等待更多帧的时间，如1ms，增大可减少系统调用但增加延迟，0表示不等待，只合并写入期间到达的帧":     "time to wait for more frames before a coalesced write on the control connection, such as 1ms; larger values save system calls but add latency, 0 means no wait and only frames arriving during a write are coalesced",
+	"与srp-client之间转发数据的压缩算法，srp-client也支持时启用，适合文本较多、链路较慢的服务，支持：%s": "compression algorithm for forwarded data between srp-server and srp-client, enabled when srp-client also supports it, suits text-heavy services over slow links, supports: %s",
+	"不支持的压缩算法：%s":             "unsupported compression algorithm: %s",
+	"解压后的有效载荷超过%d字节":          "decompressed payload exceeds %d bytes",
+	"无法解压有效载荷：%w":             "cannot decompress payload: %w",
+	"与srp-client的连接断开，无法处理数据": "connection to srp-client closed, cannot handle data",
+	"加密与srp-server之间的控制连接，以连接密码认证临时密钥交换，中间人每次握手只能猜测一次密码，截获握手也无法离线猜测，需要srp-server支持": "encrypt the control connection to srp-server with a password-authenticated ephemeral key exchange, a man in the middle can test only one password guess per handshake and captured handshakes cannot be used to guess offline, requires srp-server support",
+	"拒绝未使用-encrypt加密控制连接的srp-client":      "reject srp-clients that do not encrypt the control connection with -encrypt",
+	"连接失败，srp-server要求加密连接，请使用-encrypt参数": "connection failed, srp-server requires an encrypted connection, use -encrypt",
+	"拒绝srp-client的连接，未加密":                 "rejected srp-client connection, not encrypted",
+	"无效的公钥：%w":                            "invalid public key: %w",
+	"无效的加密记录长度%d":                         "invalid encrypted record length %d",
+	"解密失败，密码错误或数据被篡改":                     "decryption failed, wrong password or tampered data",
+	"以混淆模式连接srp-server，握手和数据没有固定特征，同时启用-encrypt，需要srp-server使用-obfs": "connect to srp-server in obfuscated mode so the handshake and data have no fixed signature, implies -encrypt, requires srp-server to use -obfs",
+	"srp-client端口只接受使用-obfs的混淆模式连接，握手和数据没有固定特征，可避免被识别和阻断":            "only accept obfuscated srp-client connections made with -obfs on the srp-client port, the handshake and data have no fixed signature so they are harder to identify and block",
+	"无效的混淆握手": "invalid obfuscated handshake",
+	"无效的混淆记录": "invalid obfuscated record",
+	"与srp-server之间的控制连接数，srp-server支持时用户连接分散到各条连接上，减少队头阻塞，最大为%d": "number of control connections to srp-server, user connections are spread across them when srp-server supports it to reduce head-of-line blocking, at most %d",
+	"conns超出范围": "conns out of range",
+	"srp-server不支持多条控制连接，只使用一条连接": "srp-server does not support multiple control connections, using only one",
+	"无效的控制连接序号%d，会话的控制连接数为%d":     "invalid control connection index %d, the session has %d control connections",
+	"隧道%s中不存在srp-client %s的会话":    "tunnel %s has no session of srp-client %s",
+	"srp-client的控制连接无法加入会话":       "srp-client control connection failed to join the session",
+	"srp-client的控制连接加入会话":         "srp-client control connection joined the session",
+	"第%d条控制连接已存在":                 "control connection %d already exists",
+	"为每个TCP用户连接单独建立与srp-server的直连数据连接，直接转发原始字节，不与其他连接共享控制连接，需要srp-server支持": "open a separate direct data connection to srp-server for each TCP user connection, forwarding raw bytes instead of sharing the control connection, requires srp-server support",
+	"srp-server不支持直连数据连接，用户连接的数据经由控制连接转发":                                   "srp-server does not support direct data connections, user connection data is forwarded over the control connection",
+	"无法构造数据：%w":                       "failed to build data: %w",
+	"请检查连接密码：%w":                      "please check the connection password: %w",
+	"srp-server可能不支持加密：%w":            "srp-server may not support encryption: %w",
+	"srp-server不支持加密":                 "srp-server does not support encryption",
+	"请检查连接密码以及srp-server是否使用-obfs：%w": "please check the connection password and whether srp-server uses -obfs: %w",
+	"拒绝用户连接，无法建立直连数据连接":               "rejecting user connection, failed to open direct data connection",
+	"无法建立直连数据连接：%s":                   "failed to open direct data connection: %s",
+	"建立直连数据连接":                        "direct data connection established",
+	"直连数据连接断开":                        "direct data connection closed",
+	"无效的cid%d":                        "invalid cid %d",
+	"无法建立直连数据连接，无法发送数据":               "failed to open direct data connection, failed to send data",
+	"保持的空闲预建数据连接数，srp-server支持时TCP用户连接直接交给空闲的连接，不经由控制连接申请，0表示不预先建立，最大为%d": "number of idle pre-established data connections to keep, when srp-server supports it TCP user connections are handed to an idle connection instead of being requested over the control connection, 0 disables the pool, max %d",
+	"为每条预建数据连接预先建立服务连接，空闲一段时间后重新建立":                                       "pre-dial a service connection for each pooled data connection, re-dialed after being idle for a while",
+	"pool超出范围": "pool out of range",
+	"预建数据连接只支持tcp协议，不预先建立数据连接":       "the connection pool only supports the tcp protocol, not pre-establishing data connections",
+	"srp-server不支持预建数据连接，不预先建立数据连接":  "srp-server does not support pooled data connections, not pre-establishing data connections",
+	"无法建立预建数据连接":                     "failed to open pooled data connection",
+	"预建数据连接断开":                       "pooled data connection closed",
+	"经由预建数据连接建立连接":                   "connection established over pooled data connection",
+	"无法预先建立服务连接":                     "failed to pre-dial service connection",
+	"会话不支持预建数据连接":                    "session does not support pooled data connections",
+	"无法建立预建数据连接，无法发送数据":              "failed to open pooled data connection, failed to send data",
+	"拒绝预建数据连接，会话已断开或空闲连接已满":          "rejecting pooled data connection, session closed or pool full",
+	"已将user的连接交给预建数据连接":              "handed user connection to pooled data connection",
+	"%s：%s，此前合并了%d次拒绝":               "%s: %s, %d earlier rejections merged",
+	"暂停读取服务的数据":                      "pausing reads from the service",
+	"恢复读取服务的数据":                      "resuming reads from the service",
+	"断开user的连接，srp-client暂停后仍持续发送数据": "closing user connection, srp-client kept sending after being paused",
+	"srp-client暂停后仍持续发送数据":           "srp-client kept sending after being paused",
+	"无法向srp-client发送数据":              "failed to send data to srp-client",
+	"隧道改为监听新的地址":                     "tunnel moved to a new address",
+	"新增%v，移除%v，更新%v，重建%v，未变化%v":      "added %v, removed %v, updated %v, recreated %v, unchanged %v",
+	"无效的公钥": "invalid public key",
+	"混淆握手的密钥需由GenerateObfsKey生成": "the obfuscated handshake key must be generated by GenerateObfsKey",
+	"忽略连接建立后的响应":                 "ignoring a connection response after the connection was set up",
+	"等待srp-client响应时user的连接已关闭":  "user connection closed while waiting for srp-client to respond",
+	"拒绝user的连接，等待srp-client响应超时": "rejecting user connection, timed out waiting for srp-client to respond",
+	"%s：等待srp-client响应超时":        "%s: timed out waiting for srp-client to respond",
+	"空闲的预建数据连接断开":                "idle pooled data connection closed",
+	"srp-server 登录":              "srp-server login",
+	"用户名或密码错误":                   "incorrect user name or password",
+	"登录失败次数过多，请稍后重试":             "too many failed logins, please try again later",
+	"用户名":              "User name",
+	"密码":               "Password",
+	"登录":               "Log in",
+	"srp-server 控制台":   "srp-server dashboard",
+	"退出":               "Log out",
+	"隧道":               "Tunnel",
+	"用户连接":             "User connections",
+	"最近事件":             "Recent events",
+	"状态":               "Status",
+	"名称":               "Name",
+	"地址":               "Address",
+	"协议类型":             "Protocol",
+	"连接数":              "Conns",
+	"上行":               "Up",
+	"下行":               "Down",
+	"流量":               "Traffic",
+	"往返时延":             "RTT",
+	"在线时长":             "Uptime",
+	"用户地址":             "User address",
+	"存活时间":             "Age",
+	"时间":               "Time",
+	"类型":               "Type",
+	"内容":               "Message",
+	"%s天%s时":           "%sd %sh",
+	"%s时%s分":           "%sh %sm",
+	"%s分%s秒":           "%sm %ss",
+	"%s秒":              "%ss",
+	"上行 %s/s，下行 %s/s":  "up %s/s, down %s/s",
+	"无":                "none",
+	"没有隧道":             "no tunnels",
+	"没有已连接的srp-client": "no connected srp-client",
+	"没有用户连接":           "no user connections",
+	"没有事件":             "no events",
+	"更新于 %s":           "updated at %s",
+	"更新失败：%s":          "update failed: %s",
+}
@@ -0,0 +1,117 @@
+// Package i18n 提供中文和英文的界面文本，
+// 代码中的中文原文即为消息的键，其它语言在消息目录中查找译文，找不到时使用原文
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	Chinese = "zh"
+	English = "en"
+)
+
+// Langs 支持的语言
+var Langs = []string{Chinese, English}
+
+var lang = Chinese
+
+// catalogs 为各语言的消息目录，中文不需要翻译
+var catalogs = map[string]map[string]string{
+	English: en,
+}
+
+// Init 根据命令行参数 -lang 或环境变量设置语言，
+// 需在定义命令行参数前调用，使参数说明也使用对应的语言
+func Init(args []string) error {
+	if l, ok := langArg(args); ok {
+		return SetLang(l)
+	}
+	return SetLang(Detect())
+}
+
+// langArg 从命令行参数中查找 -lang 的值
+func langArg(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "lang" {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// Detect 依次根据环境变量 LC_ALL、LC_MESSAGES 和 LANG 返回语言，
+// 未设置或为 C、POSIX 时返回中文，其它非中文的语言返回英文
+func Detect() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		if v == "C" || v == "POSIX" || strings.HasPrefix(v, "C.") {
+			return Chinese
+		}
+		if strings.HasPrefix(strings.ToLower(v), Chinese) {
+			return Chinese
+		}
+		return English
+	}
+	return Chinese
+}
+
+// SetLang 设置语言，支持 zh、en 以及 zh_CN.UTF-8 等形式
+func SetLang(l string) error {
+	name := strings.ToLower(l)
+	if i := strings.IndexAny(name, "_-."); i >= 0 {
+		name = name[:i]
+	}
+	switch name {
+	case Chinese, English:
+		lang = name
+		return nil
+	}
+	return fmt.Errorf(T("不支持的语言：%s，支持：%s"), l, Join(Langs))
+}
+
+// Lang 返回当前的语言
+func Lang() string {
+	return lang
+}
+
+// T 返回消息在当前语言下的文本
+func T(s string) string {
+	if t, ok := catalogs[lang][s]; ok {
+		return t
+	}
+	return s
+}
+
+// Sprintf 以当前语言的格式字符串格式化
+func Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// Errorf 以当前语言的格式字符串返回错误
+func Errorf(format string, args ...any) error {
+	return fmt.Errorf(T(format), args...)
+}
+
+// Join 以当前语言的列表分隔符连接字符串
+func Join(elems []string) string {
+	if lang == English {
+		return strings.Join(elems, ", ")
+	}
+	return strings.Join(elems, "，")
+}
@@ -1,24 +1,143 @@
 package logger
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"srp/pkg/i18n"
+	"strconv"
+	"strings"
+	"time"
 )
 
-const MaxLogLevel = 3
+// 日志级别，级别越低输出的日志越多
+const (
+	LevelTrace = slog.Level(-8)  // 转发的数据内容
+	LevelDebug = slog.LevelDebug // 每个用户连接和数据包的处理过程
+	LevelInfo  = slog.LevelInfo  // 服务启动、srp-client 连接和断开等
+	LevelWarn  = slog.LevelWarn  // 可恢复的错误
+	LevelError = slog.LevelError // 无法继续运行的错误
+)
+
+var (
+	// Levels 支持的日志级别名称
+	Levels = []string{"trace", "debug", "info", "warn", "error"}
+	// Formats 支持的日志格式
+	Formats = []string{"text", "json"}
+)
+
+// Logger 为携带固定字段的日志记录器，输出的源码位置为调用者的位置
+type Logger struct {
+	l *slog.Logger
+}
+
+var std = &Logger{slog.Default()}
+
+// ParseLevel 解析日志级别名称，兼容旧版本的数字级别：1 为 info，2 为 debug，3 为 trace
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "trace", "3":
+		return LevelTrace, nil
+	case "debug", "2":
+		return LevelDebug, nil
+	case "info", "1":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, i18n.Errorf("未知的日志级别：%s，支持：%s", s, i18n.Join(Levels))
+}
 
-func SetLogFormat() {
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+// Setup 设置日志的输出、级别和格式，并将 log 包和 slog 包的默认输出重定向到该日志
+func Setup(w io.Writer, level slog.Level, format string) error {
+	opts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       level,
+		ReplaceAttr: replaceAttr,
+	}
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return i18n.Errorf("未知的日志格式：%s，支持：%s", format, i18n.Join(Formats))
+	}
+	std = &Logger{slog.New(h)}
+	slog.SetDefault(std.l)
+	return nil
 }
 
-// LogWithLevel 根据日志级别打印日志
-// rl: real level 用户传入日志级别
-// ol: on level 指定的日志级别
-// v: 日志内容
-func LogWithLevel(rl int, ol int, v interface{}) {
-	// 判断是否需要打印
-	if (rl <= 1 && ol == 1) || rl > MaxLogLevel || rl >= ol {
-		// call depth = 2 表示向上两层获取文件名和行号
-		log.Output(2, fmt.Sprint(v))
+// replaceAttr 输出 TRACE 级别的名称，源码位置只保留文件名和行号
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
 	}
+	switch a.Key {
+	case slog.LevelKey:
+		if level, ok := a.Value.Any().(slog.Level); ok && level <= LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	case slog.SourceKey:
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			a.Value = slog.StringValue(filepath.Base(src.File) + ":" + strconv.Itoa(src.Line))
+		}
+	}
+	return a
+}
+
+// Default 返回默认的 Logger
+func Default() *Logger {
+	return std
+}
+
+// With 返回携带字段 args 的 Logger，args 的格式同 slog.Logger.With
+func With(args ...any) *Logger {
+	return std.With(args...)
+}
+
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{l.l.With(args...)}
+}
+
+// Enabled 返回是否输出 level 级别的日志，可用于避免构造不输出的日志字段
+func (l *Logger) Enabled(level slog.Level) bool {
+	return l.l.Enabled(context.Background(), level)
+}
+
+// log 记录日志，消息按当前语言翻译，源码位置取调用 Logger 方法或包函数的位置
+func (l *Logger) log(level slog.Level, msg string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	var pcs [1]uintptr
+	// 跳过 runtime.Callers、log 和 Trace 等函数
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, i18n.T(msg), pcs[0])
+	r.Add(args...)
+	l.l.Handler().Handle(context.Background(), r)
+}
+
+func (l *Logger) Trace(msg string, args ...any) { l.log(LevelTrace, msg, args...) }
+func (l *Logger) Debug(msg string, args ...any) { l.log(LevelDebug, msg, args...) }
+func (l *Logger) Info(msg string, args ...any)  { l.log(LevelInfo, msg, args...) }
+func (l *Logger) Warn(msg string, args ...any)  { l.log(LevelWarn, msg, args...) }
+func (l *Logger) Error(msg string, args ...any) { l.log(LevelError, msg, args...) }
+
+func Trace(msg string, args ...any) { std.log(LevelTrace, msg, args...) }
+func Debug(msg string, args ...any) { std.log(LevelDebug, msg, args...) }
+func Info(msg string, args ...any)  { std.log(LevelInfo, msg, args...) }
+func Warn(msg string, args ...any)  { std.log(LevelWarn, msg, args...) }
+func Error(msg string, args ...any) { std.log(LevelError, msg, args...) }
+
+// Fatal 记录 error 级别的日志后退出程序
+func Fatal(msg string, args ...any) {
+	std.log(LevelError, msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,218 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"srp/pkg/i18n"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 轮转后的旧文件名为 <Path>.<时间>，压缩后再加上 .gz 后缀
+const backupTimeFormat = "20060102-150405.000"
+
+// RotateWriter 为写入日志文件的 io.Writer，文件超过大小或使用时间后轮转为旧文件，
+// 旧文件可以压缩，并只保留最近的若干个
+type RotateWriter struct {
+	Path       string
+	MaxSize    int64         // 单个文件的最大字节数，0 表示不按大小轮转
+	MaxAge     time.Duration // 单个文件的最长使用时间，0 表示不按时间轮转
+	MaxBackups int           // 保留的旧文件数量，0 表示全部保留
+	Compress   bool          // 是否以 gzip 压缩旧文件
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	millMu sync.Mutex // 保证同一时间只有一个压缩和清理旧文件的任务
+	millWg sync.WaitGroup
+}
+
+// OpenRotateWriter 以追加方式打开日志文件，返回的 RotateWriter 使用完毕后需调用 Close
+func OpenRotateWriter(path string, maxSize int64, maxAge time.Duration, maxBackups int, compress bool) (*RotateWriter, error) {
+	w := &RotateWriter{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackups,
+		Compress:   compress,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open 调用者需持有 mu 或保证没有并发写入
+func (w *RotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size, w.openedAt = f, info.Size(), time.Now()
+	return nil
+}
+
+// Write 实现 io.Writer，写入前检查是否需要轮转
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if (w.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.MaxSize) ||
+		(w.MaxAge > 0 && time.Since(w.openedAt) >= w.MaxAge) {
+		if err := w.rotate(); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("无法轮转日志文件%s，%s", w.Path, err))
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate 立即轮转日志文件
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// rotate 调用者需持有 mu，轮转失败时继续写入当前文件
+func (w *RotateWriter) rotate() error {
+	backup := w.Path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(w.Path, backup); err != nil {
+		return err
+	}
+	old := w.file
+	if err := w.open(); err != nil {
+		// 无法创建新文件时继续写入已改名的文件
+		return err
+	}
+	old.Close()
+
+	w.millWg.Add(1)
+	go w.mill(backup)
+	return nil
+}
+
+// Reopen 关闭并重新打开日志文件，用于外部工具（如 logrotate）移动日志文件后写入新文件
+func (w *RotateWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close 关闭日志文件，并等待正在进行的压缩和清理完成
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+	w.millWg.Wait()
+	return err
+}
+
+// mill 压缩刚轮转的旧文件，并删除超出保留数量的旧文件
+func (w *RotateWriter) mill(backup string) {
+	defer w.millWg.Done()
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	if w.Compress {
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("无法压缩日志文件%s，%s", backup, err))
+		}
+	}
+	if w.MaxBackups <= 0 {
+		return
+	}
+	backups, err := w.backups()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.Sprintf("无法列出旧日志文件，%s", err))
+		return
+	}
+	for len(backups) > w.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			fmt.Fprintln(os.Stderr, i18n.Sprintf("无法删除旧日志文件%s，%s", backups[0], err))
+		}
+		backups = backups[1:]
+	}
+}
+
+// backups 返回所有轮转产生的旧文件，按时间从旧到新排序
+func (w *RotateWriter) backups() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(w.Path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(w.Path) + "."
+	var backups []string
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(name, ".gz")); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(w.Path), e.Name()))
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// compressFile 将文件压缩为 <path>.gz 并删除原文件
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
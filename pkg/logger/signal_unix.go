@@ -0,0 +1,24 @@
+//go:build !windows
+
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReopenOnSignal 在收到 SIGUSR1 时重新打开日志文件，配合 logrotate 等外部工具使用
+func ReopenOnSignal(w *RotateWriter) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			if err := w.Reopen(); err != nil {
+				Error("无法重新打开日志文件", "path", w.Path, "err", err)
+				continue
+			}
+			Info("已重新打开日志文件", "path", w.Path)
+		}
+	}()
+}
@@ -0,0 +1,6 @@
+//go:build windows
+
+package logger
+
+// ReopenOnSignal 在 Windows 上没有 SIGUSR1，不做任何处理
+func ReopenOnSignal(w *RotateWriter) {}
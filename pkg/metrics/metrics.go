@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sample 为指标的一个样本，Labels 为依次排列的标签名和标签值
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// Value 返回带有标签的样本，kv 为依次排列的标签名和标签值
+func Value(v float64, kv ...string) Sample {
+	return Sample{Labels: kv, Value: v}
+}
+
+// family 为同名指标的集合，在每次抓取时调用 collect 获取样本
+type family struct {
+	name    string
+	help    string
+	typ     string
+	collect func() []Sample
+}
+
+// Registry 以 Prometheus 文本格式输出注册的指标
+// 指标在抓取时才从程序状态中计算，热路径只需维护原子计数器
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter 注册只增不减的指标
+func (r *Registry) Counter(name, help string, collect func() []Sample) {
+	r.register(family{name, help, "counter", collect})
+}
+
+// Gauge 注册可增可减的指标
+func (r *Registry) Gauge(name, help string, collect func() []Sample) {
+	r.register(family{name, help, "gauge", collect})
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+	sort.Slice(r.families, func(i, j int) bool { return r.families[i].name < r.families[j].name })
+}
+
+// ServeHTTP 实现 http.Handler
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escape(f.help, false))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.collect() {
+			bw.WriteString(f.name)
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for i := 0; i+1 < len(s.Labels); i += 2 {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", s.Labels[i], escape(s.Labels[i+1], true))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(strconv.FormatFloat(s.Value, 'f', -1, 64))
+			bw.WriteByte('\n')
+		}
+	}
+}
+
+// escape 转义 HELP 文本和标签值中的特殊字符
+func escape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+// ListenAndServe 在 addr 上提供 /metrics 接口
+func ListenAndServe(addr string, r *Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	return http.ListenAndServe(addr, mux)
+}
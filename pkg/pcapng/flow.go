@@ -0,0 +1,242 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// 合成的 TCP 标志
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// Flow 将一条连接两个方向的载荷合成为带有 IP 和 TCP 或 UDP 头部的数据包写入 pcapng 文件，
+// TCP 连接在开始和结束时合成握手和挥手，使 Wireshark 能够重组数据流
+type Flow struct {
+	Protocol string         // tcp 或 udp
+	Client   netip.AddrPort // 发起连接的一端，即用户
+	Server   netip.AddrPort // 接受连接的一端，即被转发的服务
+
+	mu     sync.Mutex
+	w      io.WriteCloser
+	pw     *Writer
+	seq    [2]uint32 // 两个方向的下一个序号，0 为 Client 到 Server 的方向
+	ipID   uint16
+	closed bool
+}
+
+// NewFlow 在 w 中写入文件头，protocol 为 tcp 时写入三次握手，Close 时关闭 w
+func NewFlow(w io.WriteCloser, protocol string, client, server netip.AddrPort, comment string) (*Flow, error) {
+	// 地址族不同时以 IPv4 映射的 IPv6 地址表示 IPv4 地址
+	c, s := client.Addr().Unmap(), server.Addr().Unmap()
+	if c.Is4() != s.Is4() {
+		c, s = netip.AddrFrom16(c.As16()), netip.AddrFrom16(s.As16())
+	}
+	f := &Flow{
+		Protocol: protocol,
+		Client:   netip.AddrPortFrom(c, client.Port()),
+		Server:   netip.AddrPortFrom(s, server.Port()),
+		w:        w,
+		seq:      [2]uint32{1000, 2000},
+	}
+	pw, err := NewWriter(w, LinkTypeRaw, comment)
+	if err != nil {
+		return nil, err
+	}
+	f.pw = pw
+	if protocol == "tcp" {
+		now := time.Now()
+		if err := f.writeTCP(now, 0, tcpSYN, nil); err != nil {
+			return nil, err
+		}
+		f.seq[0]++
+		if err := f.writeTCP(now, 1, tcpSYN|tcpACK, nil); err != nil {
+			return nil, err
+		}
+		f.seq[1]++
+		if err := f.writeTCP(now, 0, tcpACK, nil); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Send 记录 Client 发往 Server 的载荷
+func (f *Flow) Send(payload []byte) error {
+	return f.write(0, payload)
+}
+
+// Recv 记录 Server 发往 Client 的载荷
+func (f *Flow) Recv(payload []byte) error {
+	return f.write(1, payload)
+}
+
+func (f *Flow) write(dir int, payload []byte) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	now := time.Now()
+	limit := f.maxSegment()
+	for {
+		n := min(len(payload), limit)
+		var err error
+		if f.Protocol == "tcp" {
+			err = f.writeTCP(now, dir, tcpPSH|tcpACK, payload[:n])
+			f.seq[dir] += uint32(n)
+		} else {
+			err = f.writeUDP(now, dir, payload[:n])
+		}
+		if err != nil {
+			return err
+		}
+		payload = payload[n:]
+		if len(payload) == 0 {
+			return nil
+		}
+	}
+}
+
+// Close 为 TCP 连接写入四次挥手，并关闭文件
+func (f *Flow) Close() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.Protocol == "tcp" {
+		now := time.Now()
+		f.writeTCP(now, 0, tcpFIN|tcpACK, nil)
+		f.seq[0]++
+		f.writeTCP(now, 1, tcpFIN|tcpACK, nil)
+		f.seq[1]++
+		f.writeTCP(now, 0, tcpACK, nil)
+	}
+	return f.w.Close()
+}
+
+// writeTCP 写入一个 TCP 数据包，dir 为 0 时由 Client 发往 Server
+func (f *Flow) writeTCP(ts time.Time, dir int, flags byte, payload []byte) error {
+	src, dst := f.endpoints(dir)
+	seg := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(seg[0:], src.Port())
+	binary.BigEndian.PutUint16(seg[2:], dst.Port())
+	binary.BigEndian.PutUint32(seg[4:], f.seq[dir])
+	if flags&tcpACK != 0 {
+		binary.BigEndian.PutUint32(seg[8:], f.seq[1-dir])
+	}
+	seg[12] = 5 << 4 // 头部长度为 5 个 32 位字
+	seg[13] = flags
+	binary.BigEndian.PutUint16(seg[14:], 65535) // 窗口大小
+	seg = append(seg, payload...)
+	binary.BigEndian.PutUint16(seg[16:], checksum(src.Addr(), dst.Addr(), 6, seg))
+	return f.pw.WritePacket(ts, f.ipPacket(src.Addr(), dst.Addr(), 6, seg))
+}
+
+// writeUDP 写入一个 UDP 数据包，dir 为 0 时由 Client 发往 Server
+func (f *Flow) writeUDP(ts time.Time, dir int, payload []byte) error {
+	src, dst := f.endpoints(dir)
+	seg := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(seg[0:], src.Port())
+	binary.BigEndian.PutUint16(seg[2:], dst.Port())
+	binary.BigEndian.PutUint16(seg[4:], uint16(8+len(payload)))
+	seg = append(seg, payload...)
+	sum := checksum(src.Addr(), dst.Addr(), 17, seg)
+	if sum == 0 {
+		sum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(seg[6:], sum)
+	return f.pw.WritePacket(ts, f.ipPacket(src.Addr(), dst.Addr(), 17, seg))
+}
+
+// maxSegment 返回单个合成数据包的最大载荷，保证 IP 头部的长度字段不溢出，
+// 不超过该长度的 UDP 数据报不会被拆分
+func (f *Flow) maxSegment() int {
+	n := 65535
+	if f.Client.Addr().Is4() {
+		n -= 20 // IPv4 的总长度包含 IP 头部，IPv6 的载荷长度不包含
+	}
+	if f.Protocol == "tcp" {
+		return n - 20
+	}
+	return n - 8
+}
+
+func (f *Flow) endpoints(dir int) (src, dst netip.AddrPort) {
+	if dir == 0 {
+		return f.Client, f.Server
+	}
+	return f.Server, f.Client
+}
+
+// ipPacket 为传输层数据加上 IPv4 或 IPv6 头部
+func (f *Flow) ipPacket(src, dst netip.Addr, proto byte, seg []byte) []byte {
+	if src.Is4() {
+		f.ipID++
+		p := make([]byte, 20, 20+len(seg))
+		p[0] = 0x45
+		binary.BigEndian.PutUint16(p[2:], uint16(20+len(seg)))
+		binary.BigEndian.PutUint16(p[4:], f.ipID)
+		binary.BigEndian.PutUint16(p[6:], 0x4000) // 不分片
+		p[8] = 64
+		p[9] = proto
+		s, d := src.As4(), dst.As4()
+		copy(p[12:], s[:])
+		copy(p[16:], d[:])
+		binary.BigEndian.PutUint16(p[10:], ^sum16(0, p))
+		return append(p, seg...)
+	}
+	p := make([]byte, 40, 40+len(seg))
+	p[0] = 0x60
+	binary.BigEndian.PutUint16(p[4:], uint16(len(seg)))
+	p[6] = proto
+	p[7] = 64
+	s, d := src.As16(), dst.As16()
+	copy(p[8:], s[:])
+	copy(p[24:], d[:])
+	return append(p, seg...)
+}
+
+// checksum 计算包含伪头部的 TCP 或 UDP 校验和，seg 中的校验和字段需为 0
+func checksum(src, dst netip.Addr, proto byte, seg []byte) uint16 {
+	var pseudo []byte
+	pseudo = append(pseudo, src.AsSlice()...)
+	pseudo = append(pseudo, dst.AsSlice()...)
+	if src.Is4() {
+		pseudo = append(pseudo, 0, proto)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(seg)))
+	} else {
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(seg)))
+		pseudo = append(pseudo, 0, 0, 0, proto)
+	}
+	return ^sum16(sum16(0, pseudo), seg)
+}
+
+// sum16 以 16 位反码累加 b
+func sum16(sum uint16, b []byte) uint16 {
+	s := uint32(sum)
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	for s>>16 != 0 {
+		s = s&0xFFFF + s>>16
+	}
+	return uint16(s)
+}
@@ -0,0 +1,91 @@
+// Package pcapng 以 pcapng 格式写入抓包文件，可以用 Wireshark 打开
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// LinkTypeRaw 表示数据包直接以 IPv4 或 IPv6 头部开始
+const LinkTypeRaw = 101
+
+// 块类型和选项
+const (
+	blockSectionHeader   = 0x0A0D0D0A
+	blockInterfaceDesc   = 0x00000001
+	blockEnhancedPacket  = 0x00000006
+	byteOrderMagic       = 0x1A2B3C4D
+	sectionLengthUnknown = 0xFFFFFFFFFFFFFFFF
+	optEndOfOpt          = 0
+	optComment           = 1
+)
+
+// Writer 写入 pcapng 文件，只包含一个接口，时间戳精度为微秒
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter 写入文件头和接口描述，comment 不为空时作为接口的注释
+func NewWriter(w io.Writer, linkType uint16, comment string) (*Writer, error) {
+	pw := &Writer{w: w}
+
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1) // major version
+	binary.LittleEndian.PutUint16(shb[6:], 0) // minor version
+	binary.LittleEndian.PutUint64(shb[8:], sectionLengthUnknown)
+	if err := pw.writeBlock(blockSectionHeader, shb); err != nil {
+		return nil, err
+	}
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], linkType)
+	binary.LittleEndian.PutUint32(idb[4:], 0) // snaplen，0 表示不限制
+	if comment != "" {
+		idb = appendOption(idb, optComment, []byte(comment))
+		idb = appendOption(idb, optEndOfOpt, nil)
+	}
+	if err := pw.writeBlock(blockInterfaceDesc, idb); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WritePacket 写入一个完整的数据包
+func (pw *Writer) WritePacket(ts time.Time, data []byte) error {
+	body := make([]byte, 20, 20+pad4(len(data)))
+	us := uint64(ts.UnixMicro())
+	binary.LittleEndian.PutUint32(body[0:], 0) // interface id
+	binary.LittleEndian.PutUint32(body[4:], uint32(us>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(us))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(data)))
+	body = append(body, data...)
+	body = append(body, make([]byte, pad4(len(data))-len(data))...)
+	return pw.writeBlock(blockEnhancedPacket, body)
+}
+
+// writeBlock 写入块类型、块长度、块内容和重复的块长度，块内容的长度需为 4 的倍数
+func (pw *Writer) writeBlock(typ uint32, body []byte) error {
+	total := uint32(12 + len(body))
+	b := make([]byte, 0, total)
+	b = binary.LittleEndian.AppendUint32(b, typ)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, total)
+	_, err := pw.w.Write(b)
+	return err
+}
+
+// appendOption 追加一个选项，值按 4 字节对齐
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, pad4(len(value))-len(value))...)
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"srp/pkg/i18n"
+	"srp/pkg/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit 为令牌桶的配置，Rate 为每秒产生的令牌数，Burst 为令牌桶容量
+type Limit struct {
+	Rate  int64 `json:"rate"`
+	Burst int64 `json:"burst"`
+}
+
+// ParseLimit 解析形如 10M 或 10M:20M 的限速配置，表示速率和突发容量，
+// 支持 K、M、G 单位（1024 进制），未指定突发容量时与速率相同，空字符串或 0 表示不限速
+func ParseLimit(s string) (Limit, error) {
+	if s == "" {
+		return Limit{}, nil
+	}
+	rate, burst, _ := strings.Cut(s, ":")
+	l := Limit{}
+	var err error
+	if l.Rate, err = utils.ParseSize(rate); err != nil {
+		return l, err
+	}
+	l.Burst = l.Rate
+	if burst != "" {
+		if l.Burst, err = utils.ParseSize(burst); err != nil {
+			return l, err
+		}
+	}
+	return l, nil
+}
+
+func (l Limit) String() string {
+	if l.Rate <= 0 {
+		return i18n.T("不限速")
+	}
+	return i18n.Sprintf("%dbyte/s（突发%dbyte）", l.Rate, l.Burst)
+}
+
+// NewBucket 根据配置创建令牌桶，不限速时返回 nil
+func (l Limit) NewBucket() *Bucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := l.Burst
+	if burst <= 0 {
+		burst = l.Rate
+	}
+	return &Bucket{
+		rate:   float64(l.Rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Bucket 为令牌桶，nil 的 Bucket 表示不限速
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// refill 按经过的时间补充令牌，调用者需持有锁
+func (b *Bucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Wait 取出 n 个令牌，令牌不足时阻塞到补足为止
+// n 可以大于令牌桶容量，此时令牌数变为负数，后续的调用者会等待更久
+func (b *Bucket) Wait(n int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.refill()
+	b.tokens -= float64(n)
+	var d time.Duration
+	if b.tokens < 0 {
+		d = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	time.Sleep(d)
+}
+
+// WaitAll 依次从多个令牌桶中取出 n 个令牌
+func WaitAll(n int, buckets ...*Bucket) {
+	for _, b := range buckets {
+		b.Wait(n)
+	}
+}
+
+// Allow 在令牌足够时取出 n 个令牌并返回 true，否则不取出令牌并返回 false
+func (b *Bucket) Allow(n int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
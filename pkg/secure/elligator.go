@@ -0,0 +1,183 @@
+package secure
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"math/big"
+	"slices"
+	"srp/pkg/i18n"
+	"sync"
+)
+
+// 混淆握手以 Elligator2 代表元发送公钥。X25519 公钥是曲线上的点，最高位总为 0，且约一半的 32 字节取值
+// 不是曲线上的点，猜测共享密钥后解除掩盖的公钥可以据此验证猜测；代表元在 [0, (p-1)/2] 中均匀分布，
+// 最高两位随机填充，任意 32 字节都能映射为曲线上的点，猜测正确与否无法区分。
+//
+// 标准的 X25519 公钥只落在素数阶子群中，映射回曲线后可以通过子群检查区分，因此生成公钥时加上随机的
+// 低阶点，使其均匀分布在整个曲线上；私钥标量是 8 的倍数，低阶点的分量在 ECDH 中被消除，共享密钥不变。
+
+var (
+	fieldP = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	curveA = big.NewInt(486662)
+)
+
+// lowOrder 为 Edwards25519 上的 8 个低阶点，由 initLowOrder 计算
+var (
+	lowOrderOnce sync.Once
+	lowOrder     [8]edPoint
+	sqrtM1       *big.Int // -1 的平方根
+	edwardsD     *big.Int // Edwards25519 的参数 d = -121665/121666
+)
+
+type edPoint struct{ x, y *big.Int }
+
+func fe(x int64) *big.Int { return big.NewInt(x) }
+
+func feMod(x *big.Int) *big.Int { return x.Mod(x, fieldP) }
+
+func feAdd(a, b *big.Int) *big.Int { return feMod(new(big.Int).Add(a, b)) }
+
+func feSub(a, b *big.Int) *big.Int { return feMod(new(big.Int).Sub(a, b)) }
+
+func feMul(a, b *big.Int) *big.Int { return feMod(new(big.Int).Mul(a, b)) }
+
+func feNeg(a *big.Int) *big.Int { return feMod(new(big.Int).Neg(a)) }
+
+func feInv(a *big.Int) *big.Int { return new(big.Int).ModInverse(a, fieldP) }
+
+func feDiv(a, b *big.Int) *big.Int { return feMul(a, feInv(b)) }
+
+// feIsSquare 返回 a 是否为平方数，0 视为平方数
+func feIsSquare(a *big.Int) bool {
+	e := new(big.Int).Rsh(new(big.Int).Sub(fieldP, fe(1)), 1)
+	return new(big.Int).Exp(a, e, fieldP).Cmp(fe(2)) < 0
+}
+
+// feSqrt 返回 a 的不大于 (p-1)/2 的平方根，a 不是平方数时返回 nil
+func feSqrt(a *big.Int) *big.Int {
+	// p ≡ 5 (mod 8)，候选值为 a^((p+3)/8)，其平方为 a 或 -a
+	e := new(big.Int).Rsh(new(big.Int).Add(fieldP, fe(3)), 3)
+	r := new(big.Int).Exp(a, e, fieldP)
+	if sq := feMul(r, r); sq.Cmp(feMod(new(big.Int).Set(a))) != 0 {
+		if sq.Cmp(feNeg(a)) != 0 {
+			return nil
+		}
+		r = feMul(r, sqrtM1)
+	}
+	if r.Cmp(new(big.Int).Rsh(fieldP, 1)) > 0 {
+		r = feNeg(r)
+	}
+	return r
+}
+
+// edAdd 返回 Edwards25519 上两点的和
+func edAdd(p, q edPoint) edPoint {
+	t := feMul(edwardsD, feMul(feMul(p.x, q.x), feMul(p.y, q.y)))
+	x := feDiv(feAdd(feMul(p.x, q.y), feMul(p.y, q.x)), feAdd(fe(1), t))
+	y := feDiv(feAdd(feMul(p.y, q.y), feMul(p.x, q.x)), feSub(fe(1), t))
+	return edPoint{x, y}
+}
+
+// initLowOrder 计算常量和 8 个低阶点：8 阶点 T 满足 y = ix 且 x² = (1 ± √(1+d))/d，
+// 其倍数即为全部低阶点
+func initLowOrder() {
+	sqrtM1 = new(big.Int).Exp(fe(2), new(big.Int).Rsh(new(big.Int).Sub(fieldP, fe(1)), 2), fieldP)
+	edwardsD = feDiv(fe(-121665), fe(121666))
+
+	s := feSqrt(feAdd(fe(1), edwardsD))
+	var x *big.Int
+	for _, x2 := range []*big.Int{feDiv(feAdd(fe(1), s), edwardsD), feDiv(feSub(fe(1), s), edwardsD)} {
+		if x = feSqrt(x2); x != nil {
+			break
+		}
+	}
+	t := edPoint{x, feMul(sqrtM1, x)}
+	lowOrder[0] = edPoint{fe(0), fe(1)}
+	for i := 1; i < len(lowOrder); i++ {
+		lowOrder[i] = edAdd(lowOrder[i-1], t)
+	}
+}
+
+// feFromBytes 以小端序解析 32 字节
+func feFromBytes(b []byte) *big.Int {
+	return feMod(new(big.Int).SetBytes(reversed(b)))
+}
+
+// feBytes 以小端序编码为 32 字节
+func feBytes(a *big.Int) []byte {
+	return reversed(a.FillBytes(make([]byte, 32)))
+}
+
+func reversed(b []byte) []byte {
+	b = slices.Clone(b)
+	slices.Reverse(b)
+	return b
+}
+
+// GenerateObfsKey 生成用于混淆握手的临时密钥对，公钥与 GenerateKey 相同以共享密钥 secret 派生的点为基点，
+// 均匀分布在整个曲线上并且有 Elligator2 代表元
+func GenerateObfsKey(secret string) (*KeyPair, error) {
+	lowOrderOnce.Do(initLowOrder)
+	g, err := secretGenerator(secret)
+	if err != nil {
+		return nil, err
+	}
+	var b [2]byte
+	for {
+		priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := priv.ECDH(g)
+		if err != nil {
+			return nil, err
+		}
+		rand.Read(b[:])
+		// 将 Montgomery 坐标 u 转为 Edwards 坐标，加上随机的低阶点后转回
+		u := feFromBytes(pub)
+		y := feDiv(feSub(u, fe(1)), feAdd(u, fe(1)))
+		y2 := feMul(y, y)
+		x := feSqrt(feDiv(feSub(y2, fe(1)), feAdd(feMul(edwardsD, y2), fe(1))))
+		if x == nil {
+			continue
+		}
+		q := edAdd(edPoint{x, y}, lowOrder[b[0]&7])
+		if q.y.Cmp(fe(1)) == 0 {
+			continue
+		}
+		u = feDiv(feAdd(fe(1), q.y), feSub(fe(1), q.y))
+
+		// 约一半的点有代表元，没有时重新生成
+		uA := feAdd(u, curveA)
+		if u.Sign() == 0 || uA.Sign() == 0 || !feIsSquare(feMul(fe(-2), feMul(u, uA))) {
+			continue
+		}
+		// 同一 u 对应 ±v 两个点，随机选择其中一个的代表元
+		var r *big.Int
+		if b[1]&1 == 0 {
+			r = feSqrt(feDiv(feNeg(u), feMul(fe(2), uA)))
+		} else {
+			r = feSqrt(feDiv(feNeg(uA), feMul(fe(2), u)))
+		}
+		repr := feBytes(r)
+		repr[31] |= b[1] & 0xc0
+		return &KeyPair{priv: priv, pub: feBytes(u), repr: repr}, nil
+	}
+}
+
+// publicKeyFromRepr 将 Elligator2 代表元映射为 X25519 公钥，任意 32 字节都能映射为曲线上的点
+func publicKeyFromRepr(repr []byte) ([]byte, error) {
+	if len(repr) != PublicKeySize {
+		return nil, i18n.Errorf("无效的公钥")
+	}
+	b := slices.Clone(repr)
+	b[31] &= 0x3f
+	r := feFromBytes(b)
+	// w = -A/(1+2r²)，w 对应曲线上的点时 u = w，否则 u = -w-A
+	w := feDiv(feNeg(curveA), feAdd(fe(1), feMul(fe(2), feMul(r, r))))
+	u := w
+	if !feIsSquare(feMul(w, feAdd(feMul(w, w), feAdd(feMul(curveA, w), fe(1))))) {
+		u = feSub(feNeg(w), curveA)
+	}
+	return feBytes(u), nil
+}
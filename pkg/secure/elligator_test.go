@@ -0,0 +1,126 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func TestObfsKeyRepresentative(t *testing.T) {
+	for i := range 256 {
+		k, err := GenerateObfsKey("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(k.repr) != PublicKeySize || !bytes.Equal(k.PublicKey(), k.pub) {
+			t.Fatalf("key %d: invalid key pair", i)
+		}
+		// 最高两位为随机填充，解码时忽略
+		for _, top := range []byte{0x00, 0x40, 0x80, 0xc0} {
+			repr := bytes.Clone(k.repr)
+			repr[31] = repr[31]&0x3f | top
+			pub, err := publicKeyFromRepr(repr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(pub, k.pub) {
+				t.Fatalf("key %d top %#x: representative decodes to %x, want %x", i, top, pub, k.pub)
+			}
+		}
+	}
+}
+
+func TestRepresentativeTopBits(t *testing.T) {
+	var seen [4]int
+	for range 256 {
+		k, err := GenerateObfsKey("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[k.repr[31]>>6]++
+	}
+	for top, n := range seen {
+		if n == 0 {
+			t.Fatalf("top bits %d never used: %v", top, seen)
+		}
+	}
+}
+
+func TestRepresentativeAlwaysOnCurve(t *testing.T) {
+	lowOrderOnce.Do(initLowOrder)
+	for range 256 {
+		repr := make([]byte, PublicKeySize)
+		rand.Read(repr)
+		pub, err := publicKeyFromRepr(repr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 任意代表元都映射为曲线上的点：u³+Au²+u 为平方数
+		u := feFromBytes(pub)
+		if !feIsSquare(feMul(u, feAdd(feMul(u, u), feAdd(feMul(curveA, u), fe(1))))) {
+			t.Fatalf("representative %x maps to %x, not on the curve", repr, pub)
+		}
+	}
+}
+
+func TestLowOrderPoints(t *testing.T) {
+	lowOrderOnce.Do(initLowOrder)
+	seen := make(map[string]bool)
+	for i, p := range lowOrder {
+		q := p
+		for range 3 {
+			q = edAdd(q, q)
+		}
+		if q.x.Sign() != 0 || q.y.Cmp(fe(1)) != 0 {
+			t.Fatalf("lowOrder[%d] is not of order dividing 8", i)
+		}
+		seen[p.x.String()+","+p.y.String()] = true
+	}
+	if len(seen) != len(lowOrder) {
+		t.Fatalf("%d distinct low order points, want %d", len(seen), len(lowOrder))
+	}
+}
+
+func TestObfsKeyAgreement(t *testing.T) {
+	g, err := secretGenerator("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 64 {
+		a, err := GenerateObfsKey("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := GenerateObfsKey("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 加上低阶点的公钥与原始公钥的 ECDH 结果相同
+		ab := ecdhWith(t, a, b.pub)
+		ba := ecdhWith(t, b, a.pub)
+		if !bytes.Equal(ab, ba) {
+			t.Fatalf("pair %d: shared secrets differ", i)
+		}
+		orig, err := b.priv.ECDH(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ab, ecdhWith(t, a, orig)) {
+			t.Fatalf("pair %d: low order component changed the shared secret", i)
+		}
+	}
+}
+
+func ecdhWith(t *testing.T, k *KeyPair, peer []byte) []byte {
+	t.Helper()
+	pub, err := ecdh.X25519().NewPublicKey(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := k.priv.ECDH(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shared
+}
@@ -0,0 +1,162 @@
+package secure
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	mrand "math/rand/v2"
+	"srp/pkg/i18n"
+)
+
+const (
+	// NonceSize 为混淆握手中 srp-client 发送的随机数长度
+	NonceSize = 16
+	// maxHelloPadding 为混淆握手的最大填充长度
+	maxHelloPadding = 1024
+	// maxPadding 为混淆模式下每条记录的最大填充长度
+	maxPadding = 255
+	// paddingRecordRate 为混淆模式下每次写入前插入只有填充的记录的概率的倒数
+	paddingRecordRate = 8
+)
+
+// 混淆握手的格式如下，双方掩盖公钥代表元的密钥由共享密钥和 srp-client 的随机数派生，
+// 握手中没有能用来验证共享密钥的数据，猜测错误时解除掩盖得到的同样是均匀分布的代表元，
+// 无法离线猜测共享密钥，不知道共享密钥时握手数据与随机字节无法区分
+//
+//	srp-client：随机数 16 字节 | 掩盖后的公钥代表元 32 字节 | 随机填充
+//	srp-server：掩盖后的公钥代表元 32 字节 | 一条只有填充的加密记录
+//
+// srp-client 此时还没有加密的密钥，填充长度由随机数决定而与共享密钥无关；
+// srp-server 的填充长度位于加密的记录中
+
+// WriteClientHello 发送 srp-client 的混淆握手，返回其中的随机数，用于读取 srp-server 的握手，
+// key 需由 GenerateObfsKey 生成
+func WriteClientHello(w io.Writer, key *KeyPair, secret string) ([]byte, error) {
+	nonce := make([]byte, NonceSize)
+	rand.Read(nonce)
+	b, err := appendHello(nonce, nonce, key, secret, "srp obfs client hello")
+	if err != nil {
+		return nil, err
+	}
+	padding := clientHelloPadding(nonce)
+	b = append(b, make([]byte, padding)...)
+	rand.Read(b[len(b)-padding:])
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// ReadClientHello 读取 srp-client 的混淆握手，返回其中的随机数和 srp-client 的公钥，
+// 共享密钥不一致时公钥为无意义的数据，之后解密失败
+func ReadClientHello(r io.Reader, secret string) (nonce, peer []byte, err error) {
+	nonce = make([]byte, NonceSize)
+	if _, err = io.ReadFull(r, nonce); err != nil {
+		return nil, nil, err
+	}
+	if peer, err = readHello(r, nonce, secret, "srp obfs client hello"); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(clientHelloPadding(nonce))); err != nil {
+		return nil, nil, err
+	}
+	return nonce, peer, nil
+}
+
+// WriteServerHello 发送 srp-server 的混淆握手，c 为使用 key 派生的密钥的混淆模式连接，
+// nonce 为 srp-client 握手中的随机数
+func (c *Conn) WriteServerHello(key *KeyPair, secret string, nonce []byte) error {
+	b, err := appendHello(nil, nonce, key, secret, "srp obfs server hello")
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	b = c.appendRecord(b, nil, maxHelloPadding)
+	_, err = c.Conn.Write(b)
+	return err
+}
+
+// ReadServerHello 读取 srp-server 的混淆握手中的公钥代表元，返回 srp-server 的公钥，
+// 之后的填充记录由 ReadHelloRecord 读取
+func ReadServerHello(r io.Reader, secret string, nonce []byte) ([]byte, error) {
+	return readHello(r, nonce, secret, "srp obfs server hello")
+}
+
+// ReadHelloRecord 读取 srp-server 握手中只有填充的记录，共享密钥不一致时解密失败，
+// 使 srp-client 在握手时即可发现密码错误
+func (c *Conn) ReadHelloRecord() error {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	return c.readRecord()
+}
+
+// helloMask 返回掩盖公钥代表元的密钥
+func helloMask(secret string, nonce []byte, info string) ([]byte, error) {
+	return hkdf.Key(sha256.New, []byte(secret), nonce, info, PublicKeySize)
+}
+
+// clientHelloPadding 返回 srp-client 握手的填充长度，由随机数决定，srp-server 据此找到握手的结尾
+func clientHelloPadding(nonce []byte) int {
+	sum := sha256.Sum256(append([]byte("srp obfs client hello padding"), nonce...))
+	return int(binary.BigEndian.Uint16(sum[:])) % (maxHelloPadding + 1)
+}
+
+// appendHello 将掩盖后的公钥代表元追加到 b
+func appendHello(b, nonce []byte, key *KeyPair, secret string, info string) ([]byte, error) {
+	if key.repr == nil {
+		return nil, i18n.Errorf("混淆握手的密钥需由GenerateObfsKey生成")
+	}
+	mask, err := helloMask(secret, nonce, info)
+	if err != nil {
+		return nil, err
+	}
+	start := len(b)
+	b = append(b[:start:start], key.repr...)
+	for i := range mask {
+		b[start+i] ^= mask[i]
+	}
+	return b, nil
+}
+
+func readHello(r io.Reader, nonce []byte, secret string, info string) ([]byte, error) {
+	mask, err := helloMask(secret, nonce, info)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, PublicKeySize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	for i := range mask {
+		b[i] ^= mask[i]
+	}
+	return publicKeyFromRepr(b)
+}
+
+// randomPaddingRecord 返回本次写入前是否插入只有填充的记录
+func randomPaddingRecord() bool {
+	return mrand.IntN(paddingRecordRate) == 0
+}
+
+// appendPadding 在明文后添加不超过 limit 的随机长度的随机填充和 2 字节的填充长度
+func appendPadding(b []byte, limit int) []byte {
+	padding := mrand.IntN(limit + 1)
+	b = append(b, make([]byte, padding)...)
+	rand.Read(b[len(b)-padding:])
+	return binary.BigEndian.AppendUint16(b, uint16(padding))
+}
+
+// unpad 去除 appendPadding 添加的填充
+func unpad(b []byte) ([]byte, error) {
+	if len(b) < 2 {
+		return nil, i18n.Errorf("无效的混淆记录")
+	}
+	padding := int(binary.BigEndian.Uint16(b[len(b)-2:]))
+	if padding > len(b)-2 {
+		return nil, i18n.Errorf("无效的混淆记录")
+	}
+	return b[:len(b)-2-padding], nil
+}
@@ -0,0 +1,126 @@
+package secure
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// obfsServer 按 srp-server 的流程完成混淆握手
+func obfsServer(conn net.Conn, secret string) (*Conn, error) {
+	nonce, peer, err := ReadClientHello(conn, secret)
+	if err != nil {
+		return nil, err
+	}
+	key, err := GenerateObfsKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := key.DeriveKeys(peer, secret, false)
+	if err != nil {
+		return nil, err
+	}
+	sc := NewObfsConn(conn, nil, keys)
+	if err := sc.WriteServerHello(key, secret, nonce); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// obfsClient 按 srp-client 的流程完成混淆握手
+func obfsClient(conn net.Conn, secret string) (*Conn, error) {
+	key, err := GenerateObfsKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := WriteClientHello(conn, key, secret)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := ReadServerHello(conn, secret, nonce)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := key.DeriveKeys(peer, secret, true)
+	if err != nil {
+		return nil, err
+	}
+	sc := NewObfsConn(conn, nil, keys)
+	if err := sc.ReadHelloRecord(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func TestObfsHandshake(t *testing.T) {
+	for i := range 16 {
+		c, s := net.Pipe()
+		type result struct {
+			conn *Conn
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			sc, err := obfsServer(s, "secret")
+			done <- result{sc, err}
+		}()
+		cc, err := obfsClient(c, "secret")
+		if err != nil {
+			t.Fatalf("handshake %d: client: %v", i, err)
+		}
+		r := <-done
+		if r.err != nil {
+			t.Fatalf("handshake %d: server: %v", i, r.err)
+		}
+
+		// 两个方向各传输一次，包括超过一条记录的数据
+		for _, tc := range []struct{ from, to *Conn }{{cc, r.conn}, {r.conn, cc}} {
+			msg := bytes.Repeat([]byte{byte(i)}, maxRecordSize+1000)
+			go tc.from.Write(msg)
+			got := make([]byte, len(msg))
+			if _, err := io.ReadFull(tc.to, got); err != nil {
+				t.Fatalf("handshake %d: read: %v", i, err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Fatalf("handshake %d: data corrupted", i)
+			}
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestObfsHandshakeWrongSecret(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	go func() {
+		obfsServer(s, "secret")
+		s.Close()
+	}()
+	if _, err := obfsClient(c, "wrong"); err == nil {
+		t.Fatal("handshake with a wrong secret succeeded")
+	}
+}
+
+func TestClientHelloLength(t *testing.T) {
+	key, err := GenerateObfsKey("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	nonce, err := WriteClientHello(&buf, key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 握手长度只由随机数决定，与共享密钥无关
+	if want := NonceSize + PublicKeySize + clientHelloPadding(nonce); buf.Len() != want {
+		t.Fatalf("client hello is %d bytes, want %d", buf.Len(), want)
+	}
+	if _, _, err := ReadClientHello(&buf, "wrong"); err != nil {
+		t.Fatalf("ReadClientHello with a wrong secret: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("%d bytes left after the client hello", buf.Len())
+	}
+}
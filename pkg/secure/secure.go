@@ -0,0 +1,291 @@
+// Package secure 在连接上提供基于共享密钥的认证加密，不需要证书
+//
+// 密钥交换为 CPace 方式的口令认证密钥交换：X25519 的基点不是标准基点，而是将共享密钥的哈希以 Elligator2
+// 映射到曲线上得到的点，双方各自生成临时私钥并交换私钥与该基点的乘积，以 ECDH 的结果和共享密钥作为
+// HKDF-SHA256 的输入，双方的公钥作为盐，为两个方向分别派生 AES-256-GCM 密钥。临时密钥在连接结束后丢弃，
+// 提供前向安全；不知道共享密钥的一方无法派生相同的密钥，第一条记录即解密失败。
+// 交换的公钥与随机的曲线点无法区分，中间人每次握手只能验证一次猜测的共享密钥，截获的握手不能用于离线猜测。
+//
+// 加密后的数据以记录为单位传输，每条记录为 4 字节大端序的密文长度和密文，
+// 随机数为每个方向从 0 开始递增的序号，记录被重放、重排或篡改时解密失败。
+//
+// 混淆模式下握手数据与随机字节无法区分，公钥以 Elligator2 代表元发送，记录长度经过掩盖，
+// 每条记录带有随机长度的填充，并随机插入只有填充的记录，使流量没有固定的特征，见 obfs.go
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"srp/pkg/i18n"
+	"sync"
+)
+
+const (
+	// PublicKeySize 为 X25519 公钥的长度
+	PublicKeySize = 32
+	// maxRecordSize 为一条记录的明文最大长度，更长的写入拆分为多条记录
+	maxRecordSize = 64 << 10
+	// overhead 为 AES-GCM 认证标签的长度
+	overhead = 16
+)
+
+// KeyPair 为一次连接使用的临时密钥对
+type KeyPair struct {
+	priv *ecdh.PrivateKey
+	pub  []byte // 私钥与共享密钥派生的基点的乘积，GenerateObfsKey 生成时还加上了低阶点
+	repr []byte // 公钥的 Elligator2 代表元，只由 GenerateObfsKey 设置
+}
+
+// GenerateKey 生成临时的 X25519 密钥对，公钥以共享密钥 secret 派生的点为基点
+func GenerateKey(secret string) (*KeyPair, error) {
+	g, err := secretGenerator(secret)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := priv.ECDH(g)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{priv: priv, pub: pub}, nil
+}
+
+// secretGenerator 返回由共享密钥派生的基点：以 HKDF 将共享密钥扩展为 32 字节，作为代表元映射到曲线上
+func secretGenerator(secret string) (*ecdh.PublicKey, error) {
+	repr, err := hkdf.Key(sha256.New, []byte(secret), nil, "srp cpace generator", PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	u, err := publicKeyFromRepr(repr)
+	if err != nil {
+		return nil, err
+	}
+	return ecdh.X25519().NewPublicKey(u)
+}
+
+// PublicKey 返回发送给对端的公钥
+func (k *KeyPair) PublicKey() []byte {
+	return k.pub
+}
+
+// Keys 为一个连接两个方向的密钥
+type Keys struct {
+	send cipher.AEAD
+	recv cipher.AEAD
+
+	// 混淆模式下掩盖记录长度的密钥流
+	sendMask cipher.Stream
+	recvMask cipher.Stream
+}
+
+// DeriveKeys 根据本端的密钥对、对端的公钥和共享密钥 secret 派生两个方向的密钥，
+// client 表示本端是否为发起连接的一方，双方的取值需相反
+func (k *KeyPair) DeriveKeys(peer []byte, secret string, client bool) (*Keys, error) {
+	peerKey, err := ecdh.X25519().NewPublicKey(peer)
+	if err != nil {
+		return nil, i18n.Errorf("无效的公钥：%w", err)
+	}
+	shared, err := k.priv.ECDH(peerKey)
+	if err != nil {
+		return nil, i18n.Errorf("无效的公钥：%w", err)
+	}
+	clientPub, serverPub := k.PublicKey(), peer
+	if !client {
+		clientPub, serverPub = serverPub, clientPub
+	}
+	salt := append(append([]byte{}, clientPub...), serverPub...)
+	ikm := append(shared, secret...)
+
+	c2s, err := newAEAD(ikm, salt, "srp client to server")
+	if err != nil {
+		return nil, err
+	}
+	s2c, err := newAEAD(ikm, salt, "srp server to client")
+	if err != nil {
+		return nil, err
+	}
+	c2sMask, err := newStream(ikm, salt, "srp client to server length")
+	if err != nil {
+		return nil, err
+	}
+	s2cMask, err := newStream(ikm, salt, "srp server to client length")
+	if err != nil {
+		return nil, err
+	}
+	if client {
+		return &Keys{send: c2s, recv: s2c, sendMask: c2sMask, recvMask: s2cMask}, nil
+	}
+	return &Keys{send: s2c, recv: c2s, sendMask: s2cMask, recvMask: c2sMask}, nil
+}
+
+func newAEAD(ikm, salt []byte, info string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, ikm, salt, info, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newStream(ikm, salt []byte, info string) (cipher.Stream, error) {
+	key, err := hkdf.Key(sha256.New, ikm, salt, info, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, make([]byte, aes.BlockSize)), nil
+}
+
+// Conn 为加密的连接，Read 从 r 读取记录并解密，Write 加密后写入底层连接，
+// 其他方法使用底层连接的实现
+type Conn struct {
+	net.Conn
+	r    io.Reader
+	keys *Keys
+	obfs bool // 是否为混淆模式
+
+	rmu     sync.Mutex
+	recvSeq uint64
+	rbuf    []byte // 读取记录的缓冲区
+	plain   []byte // 已解密未读取的明文，指向 rbuf
+
+	wmu     sync.Mutex
+	sendSeq uint64
+	wbuf    []byte
+}
+
+// NewConn 返回加密的连接，r 为读取底层连接的 Reader，握手时已经使用 bufio.Reader 读取时传入该 Reader，
+// 避免丢失其中缓冲的数据，为 nil 时直接读取 conn
+func NewConn(conn net.Conn, r io.Reader, keys *Keys) *Conn {
+	if r == nil {
+		r = conn
+	}
+	return &Conn{Conn: conn, r: r, keys: keys}
+}
+
+// NewObfsConn 返回混淆模式的加密连接，参数同 NewConn，双方需使用混淆握手交换公钥
+func NewObfsConn(conn net.Conn, r io.Reader, keys *Keys) *Conn {
+	c := NewConn(conn, r, keys)
+	c.obfs = true
+	return c
+}
+
+func nonce(seq uint64) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[4:], seq)
+	return n
+}
+
+// Read 实现 net.Conn 的 Read
+func (c *Conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	// 混淆模式下只有填充的记录没有数据，继续读取
+	for len(c.plain) == 0 {
+		if err := c.readRecord(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.plain)
+	c.plain = c.plain[n:]
+	return n, nil
+}
+
+func (c *Conn) readRecord() error {
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+	if c.obfs {
+		c.keys.recvMask.XORKeyStream(header[:], header[:])
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < overhead || size > maxRecordSize+overhead {
+		return i18n.Errorf("无效的加密记录长度%d", size)
+	}
+	if cap(c.rbuf) < int(size) {
+		c.rbuf = make([]byte, maxRecordSize+overhead)
+	}
+	record := c.rbuf[:size]
+	if _, err := io.ReadFull(c.r, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	plain, err := c.keys.recv.Open(record[:0], nonce(c.recvSeq), record, header[:])
+	if err != nil {
+		return i18n.Errorf("解密失败，密码错误或数据被篡改")
+	}
+	c.recvSeq++
+	if c.obfs {
+		if plain, err = unpad(plain); err != nil {
+			return err
+		}
+	}
+	c.plain = plain
+	return nil
+}
+
+// Write 实现 net.Conn 的 Write，p 超过一条记录的长度时拆分为多条记录，以一次写入发送
+func (c *Conn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	b := c.wbuf[:0]
+	if c.obfs && randomPaddingRecord() {
+		b = c.appendRecord(b, nil, maxPadding)
+	}
+	for rest := p; len(rest) > 0; {
+		size := maxRecordSize
+		if c.obfs {
+			size -= maxPadding + 2
+		}
+		chunk := rest[:min(len(rest), size)]
+		rest = rest[len(chunk):]
+		b = c.appendRecord(b, chunk, maxPadding)
+	}
+	// 突发写入使缓冲区变得很大时不再复用
+	if cap(b) <= 4*(maxRecordSize+overhead+4) {
+		c.wbuf = b
+	}
+	if _, err := c.Conn.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendRecord 将 chunk 加密为一条记录追加到 b，混淆模式下先添加不超过 padding 的随机长度的填充并掩盖记录长度
+func (c *Conn) appendRecord(b, chunk []byte, padding int) []byte {
+	start := len(b)
+	if !c.obfs {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(chunk)+overhead))
+		b = c.keys.send.Seal(b, nonce(c.sendSeq), chunk, b[start:start+4])
+		c.sendSeq++
+		return b
+	}
+	// 明文和填充先写在密文的位置，原地加密
+	b = binary.BigEndian.AppendUint32(b, 0)
+	plain := appendPadding(append(b[start+4:], chunk...), padding)
+	binary.BigEndian.PutUint32(b[start:], uint32(len(plain)+overhead))
+	header := [4]byte(b[start : start+4])
+	b = c.keys.send.Seal(b[:start+4], nonce(c.sendSeq), plain, header[:])
+	c.sendSeq++
+	c.keys.sendMask.XORKeyStream(b[start:start+4], b[start:start+4])
+	return b
+}
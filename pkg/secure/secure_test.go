@@ -0,0 +1,42 @@
+package secure
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyAgreementSecret(t *testing.T) {
+	for _, tt := range []struct {
+		client, server string
+		agree          bool
+	}{
+		{"secret", "secret", true},
+		{"secret", "Secret", false},
+		{"", "", true},
+	} {
+		a, err := GenerateKey(tt.client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := GenerateKey(tt.server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 基点由共享密钥派生，不一致时 ECDH 的结果不同
+		ab := ecdhWith(t, a, b.PublicKey())
+		ba := ecdhWith(t, b, a.PublicKey())
+		if bytes.Equal(ab, ba) != tt.agree {
+			t.Fatalf("secrets %q and %q: agree %t, want %t", tt.client, tt.server, !tt.agree, tt.agree)
+		}
+	}
+}
+
+func TestPublicKeyNotStandardBase(t *testing.T) {
+	k, err := GenerateKey("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(k.PublicKey(), k.priv.PublicKey().Bytes()) {
+		t.Fatal("public key uses the standard X25519 base point")
+	}
+}
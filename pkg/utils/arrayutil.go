@@ -1,10 +1,24 @@
 package utils
 
-import "strings"
+import (
+	"srp/pkg/i18n"
+	"strings"
+)
 
 func Protocols2String(p []string) string {
 	for i := range p {
-		p[i] = p[i] + "协议"
+		p[i] = p[i] + i18n.T("协议")
 	}
-	return strings.Join(p, "，")
+	return i18n.Join(p)
+}
+
+// SplitList 以逗号分隔字符串，忽略空白项
+func SplitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
 }
@@ -0,0 +1,15 @@
+package utils
+
+import "strings"
+
+// StringSlice 实现 flag.Value，用于可重复指定的命令行参数
+type StringSlice []string
+
+func (s *StringSlice) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *StringSlice) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"net"
+	"net/netip"
+)
+
+// AddrIP 返回地址中的 IP 部分，IPv4-mapped IPv6 地址被转换为 IPv4 地址，并去除 IPv6 zone，
+// 使同一来源的不同表示形式得到相同的结果，无法解析时返回 false
+func AddrIP(addr net.Addr) (netip.Addr, bool) {
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.AddrPort().Addr()
+	case *net.UDPAddr:
+		ip = a.AddrPort().Addr()
+	case nil:
+		return ip, false
+	default:
+		ap, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return ip, false
+		}
+		ip = ap.Addr()
+	}
+	return ip.Unmap().WithZone(""), ip.IsValid()
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"math"
+	"srp/pkg/i18n"
+	"strconv"
+	"strings"
+)
+
+// ParseSize 解析形如 512、64K、10M、1G 的字节数，单位为 1024 进制
+func ParseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, i18n.Errorf("无效的大小：%q", s)
+	}
+	unit := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		unit = 1 << 10
+	case "M":
+		unit = 1 << 20
+	case "G":
+		unit = 1 << 30
+	}
+	num := s
+	if unit > 1 {
+		num = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	// 溢出的结果为负数，会被当作不限制
+	if err != nil || n < 0 || n > math.MaxInt64/unit {
+		return 0, i18n.Errorf("无效的大小：%q", s)
+	}
+	return n * unit, nil
+}